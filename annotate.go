@@ -0,0 +1,52 @@
+package main
+
+// AnnotateMemory attaches note to addr, replacing any note already there.
+// Notes are shown beside their line in the display and in AnnotatedDump,
+// and unlike assembler labels are kept across Reset and Reboot. An empty
+// note clears the annotation; addresses outside the store are ignored.
+func (b *baby) AnnotateMemory(addr int32, note string) {
+	if addr < 0 || addr >= words {
+		return
+	}
+	if note == "" {
+		b.ClearAnnotation(addr)
+		return
+	}
+
+	if b.annotations == nil {
+		b.annotations = make(map[int32]string)
+	}
+	b.annotations[addr] = note
+}
+
+// GetAnnotation returns the note attached to addr, or an empty string if
+// there isn't one.
+func (b *baby) GetAnnotation(addr int32) string {
+	return b.annotations[addr]
+}
+
+// ClearAnnotation removes any note attached to addr.
+func (b *baby) ClearAnnotation(addr int32) {
+	delete(b.annotations, addr)
+}
+
+// ExportAnnotations returns a copy of the notes attached to the store, by
+// address.
+func (b *baby) ExportAnnotations() map[int32]string {
+	m := make(map[int32]string, len(b.annotations))
+	for addr, note := range b.annotations {
+		m[addr] = note
+	}
+
+	return m
+}
+
+// ImportAnnotations replaces the notes attached to the store with those in
+// m, as returned by ExportAnnotations. Empty notes and addresses outside
+// the store are skipped.
+func (b *baby) ImportAnnotations(m map[int32]string) {
+	b.annotations = nil
+	for addr, note := range m {
+		b.AnnotateMemory(addr, note)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnnotateMemory(t *testing.T) {
+	b := NewBaby(loopMem())
+	var out strings.Builder
+	b.ConnectTerminal(strings.NewReader(""), &out)
+
+	b.AnnotateMemory(5, "loop counter")
+	b.AnnotateMemory(-1, "outside")
+	b.AnnotateMemory(words, "outside")
+	b.Step()
+	b.Reset()
+
+	b.Display()
+	if !strings.Contains(out.String(), "loop counter") {
+		t.Errorf("Display() doesn't show the annotation:\n%s", out.String())
+	}
+	lines := strings.Split(b.AnnotatedDump(), "\n")
+	if !strings.HasSuffix(lines[5], " | loop counter") {
+		t.Errorf("AnnotatedDump() line 5 = %q, want the annotation", lines[5])
+	}
+
+	cases := []struct {
+		addr int32
+		want string
+	}{
+		{5, "loop counter"},
+		{4, ""},
+		{-1, ""},
+		{words, ""},
+	}
+
+	for i, tc := range cases {
+		if got := b.GetAnnotation(tc.addr); got != tc.want {
+			t.Errorf("case %d: got(%q) != want(%q)", i, got, tc.want)
+		}
+	}
+
+	b.AnnotateMemory(5, "counter")
+	if got := b.GetAnnotation(5); got != "counter" {
+		t.Errorf("after replacing, GetAnnotation(5) = %q, want \"counter\"", got)
+	}
+	b.ClearAnnotation(5)
+	if got := b.GetAnnotation(5); got != "" || strings.Contains(b.AnnotatedDump(), "counter") {
+		t.Errorf("after ClearAnnotation, GetAnnotation(5) = %q", got)
+	}
+	b.AnnotateMemory(6, "x")
+	b.AnnotateMemory(6, "")
+	if got := b.GetAnnotation(6); got != "" {
+		t.Errorf("after an empty note, GetAnnotation(6) = %q", got)
+	}
+}
+
+func TestExportImportAnnotations(t *testing.T) {
+	a := NewBaby(loopMem())
+	a.AnnotateMemory(1, "decrement")
+	a.AnnotateMemory(5, "loop counter")
+
+	m := a.ExportAnnotations()
+	want := map[int32]string{1: "decrement", 5: "loop counter"}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("ExportAnnotations() = %v, want %v", m, want)
+	}
+	// The export is a copy.
+	m[2] = "changed"
+	if got := a.GetAnnotation(2); got != "" {
+		t.Errorf("changing the export annotated line 2 with %q", got)
+	}
+
+	b := NewBaby(loopMem())
+	b.AnnotateMemory(7, "replaced")
+	b.ImportAnnotations(map[int32]string{1: "decrement", 5: "loop counter", 6: "", words: "outside"})
+	if got := b.ExportAnnotations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after ImportAnnotations, ExportAnnotations() = %v, want %v", got, want)
+	}
+	if got, want := b.AnnotatedDump(), a.AnnotatedDump(); got != want {
+		t.Errorf("AnnotatedDump() after import:\n%s\nwant:\n%s", got, want)
+	}
+}
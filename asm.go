@@ -0,0 +1,621 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	badLength = errors.New("invalid binary code - word must be exactly 32 bits")
+	badRange  = errors.New("invalid code - operand outside the store")
+
+	unknownLabel    = errors.New("invalid code - unknown label")
+	duplicateLabel  = errors.New("invalid code - duplicate label")
+	badLabelAddress = errors.New("invalid code - label beyond the end of the store")
+	emptyProgram    = errors.New("invalid program - no instructions found")
+	poolOverflow    = errors.New("invalid program - no room in the store for constants")
+)
+
+// sourceLine records how one line of program source was assembled.
+type sourceLine struct {
+	line int          // 1-based line number in the source
+	addr int32        // store line the entry was placed on
+	word int32        // the assembled word
+	inst *instruction // nil for data words
+	text string       // the source text
+}
+
+// program is an assembled program: the resulting store plus a record of
+// where each word came from.
+type program struct {
+	mem    memory
+	lines  []sourceLine
+	labels map[string]int32
+	entry  int32 // first line to execute, -1 if not given
+}
+
+// assembler holds the options that control how program source is read.
+type assembler struct {
+	// strict rejects binary words that aren't exactly 32 digits and
+	// instructions whose operand is outside the store.
+	strict bool
+	// echo, when set, receives a line for each entry as it is assembled.
+	echo io.Writer
+}
+
+// assembleFile assembles the program in the file at path with the default
+// options.
+func assembleFile(path string) (*program, error) {
+	return assembler{}.assembleFile(path)
+}
+
+// assemble reads a baby program from r with the default options.
+func assemble(r io.Reader) (*program, error) {
+	return assembler{}.assemble(r)
+}
+
+// assembleFile assembles the program in the file at path.
+func (a assembler) assembleFile(path string) (*program, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading programfile: %v", err)
+	}
+
+	return a.assembleProgram(bytes.NewReader(data))
+}
+
+// assembleInline assembles a program given on a single line, such as
+// "0010 LDN 21;0011 STP". Each ";" separates two lines, so inline programs
+// can't have comments.
+func (a assembler) assembleInline(src string) (*program, error) {
+	return a.assembleProgram(strings.NewReader(strings.ReplaceAll(src, ";", "\n")))
+}
+
+// assembleProgram is like assemble, but rejects a program with no entries,
+// such as an empty file or one of only comments, with emptyProgram rather
+// than running a store of zeros.
+func (a assembler) assembleProgram(r io.Reader) (*program, error) {
+	p, err := a.assemble(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.lines) == 0 {
+		return nil, emptyProgram
+	}
+
+	return p, nil
+}
+
+// assembleSource assembles the inline program src if it isn't empty and
+// the program in the file at path otherwise.
+func (a assembler) assembleSource(src, path string) (*program, error) {
+	if src != "" {
+		return a.assembleInline(src)
+	}
+
+	return a.assembleFile(path)
+}
+
+// assemble reads a baby program from r. See loadProgramFromReader for the
+// accepted formats. NUM entries are recorded as data; binary entries are
+// recorded as instructions when they are a non-zero, exact instruction
+// encoding and as data otherwise.
+//
+// Any entry may be preceded by a label, "loop: SUB 21", and instruction
+// operands may name a label instead of giving an address. A label on a line
+// of its own refers to the next entry. Execution starts at the line named
+// by an ".entry <label|addr>" directive or, failing that, a "start" label.
+//
+// An operand may also be a constant, "LDN =-1000", which is placed in a
+// data word of its own and replaced by that word's address; see
+// placeConstants. With echo set, such instructions are echoed only once
+// their operand is known, after the rest of the program, followed by the
+// constants.
+func (a assembler) assemble(r io.Reader) (*program, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading program: %v", err)
+	}
+	lines := strings.Split(string(data), "\n")
+
+	p := &program{entry: -1}
+	if p.labels, err = collectLabels(lines); err != nil {
+		return nil, err
+	}
+
+	var (
+		next   int32
+		entry  string
+		pool   string
+		consts []constRef
+	)
+	for i, line := range lines {
+		_, line = splitLabel(line)
+		if line == "" {
+			continue
+		}
+
+		if arg, ok := directive(line, ".entry"); ok {
+			entry = arg
+			continue
+		}
+		if arg, ok := directive(line, ".pool"); ok {
+			pool = arg
+			continue
+		}
+
+		sl := sourceLine{line: i + 1, text: line}
+		isConst := false // echoed once placeConstants has resolved it
+		if strings.Contains(line, ":") {
+			n, m, err := memFromBin(line)
+			if err != nil {
+				return nil, fmt.Errorf("error on line %d: %v", i+1, err)
+			}
+			if a.strict && len(strings.SplitN(line, ":", 2)[1]) != 32 {
+				return nil, fmt.Errorf("error on line %d: %v", i+1, badLength)
+			}
+			sl.addr, sl.word = n, m
+			if inst := instFromWord(m); m != 0 && inst.toInt32() == m {
+				sl.inst = inst
+			}
+		} else {
+			code, v, ok, err := constOperand(withAddress(line, next))
+			if err != nil {
+				return nil, fmt.Errorf("error on line %d: %v", i+1, err)
+			}
+			if isConst = ok; isConst {
+				consts = append(consts, constRef{len(p.lines), v})
+			}
+			code, err = p.resolveLabels(code)
+			if err != nil {
+				return nil, fmt.Errorf("error on line %d: %v", i+1, err)
+			}
+			n, inst, err := instructionFromCode(code)
+			if err != nil {
+				return nil, fmt.Errorf("error on line %d: %v", i+1, err)
+			}
+			sl.addr, sl.word = n, inst.toInt32()
+			if _, pseudo := pseudoOps[strings.SplitN(code, " ", 3)[1]]; !pseudo {
+				sl.inst = inst
+			}
+			if a.strict && sl.inst != nil && (inst.data < 0 || inst.data >= words) {
+				return nil, fmt.Errorf("error on line %d: %v", i+1, badRange)
+			}
+		}
+
+		p.mem[sl.addr] = sl.word
+		p.lines = append(p.lines, sl)
+		if !isConst {
+			a.echoLine(sl)
+		}
+		next = sl.addr + 1
+	}
+
+	if len(consts) > 0 {
+		start := int32(-1)
+		if pool != "" {
+			if start, err = p.resolveAddress(pool); err != nil {
+				return nil, fmt.Errorf("error in .pool: %v", err)
+			}
+		}
+		n := len(p.lines)
+		if err := p.placeConstants(consts, start); err != nil {
+			return nil, err
+		}
+		for _, c := range consts {
+			a.echoLine(p.lines[c.line])
+		}
+		for _, sl := range p.lines[n:] {
+			a.echoLine(sl)
+		}
+	}
+
+	if entry == "" {
+		if _, ok := p.labels["start"]; ok {
+			entry = "start"
+		}
+	}
+	if entry != "" {
+		if p.entry, err = p.resolveAddress(entry); err != nil {
+			return nil, fmt.Errorf("error in .entry: %v", err)
+		}
+	}
+
+	return p, nil
+}
+
+// echoLine writes the source of sl, the line it was placed on and the
+// word it assembled to, in binary and decimal, to the echo writer.
+func (a assembler) echoLine(sl sourceLine) {
+	if a.echo == nil {
+		return
+	}
+
+	fmt.Fprintf(a.echo, "%4d: %-24s => %04d:%s %d\n", sl.line, sl.text, sl.addr, EncodeWord(sl.word), sl.word)
+}
+
+// constRef is an instruction whose operand is a constant.
+type constRef struct {
+	line  int // index of the instruction in program.lines
+	value int32
+}
+
+// constOperand replaces a constant operand, "=value", in an addressed line
+// of code with address 0, returning the value and whether there was one.
+func constOperand(code string) (string, int32, bool, error) {
+	parts := strings.SplitN(code, " ", 3)
+	if len(parts) < 3 || !strings.HasPrefix(parts[2], "=") {
+		return code, 0, false, nil
+	}
+	if _, pseudo := pseudoOps[parts[1]]; pseudo {
+		return "", 0, false, badOperand
+	}
+
+	v, err := numOp(strings.TrimSpace(parts[2][1:]))
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	return fmt.Sprintf("%s %s 0", parts[0], parts[1]), v, true, nil
+}
+
+// placeConstants stores each distinct constant in consts in a data word
+// and points the instructions using it there. The words are placed in
+// order from start, skipping lines the program sets; a start of -1 places
+// them after the highest line the program sets or refers to. poolOverflow
+// is returned if they run past the end of the store.
+func (p *program) placeConstants(consts []constRef, start int32) error {
+	used := make(map[int32]int, len(p.lines)) // line to the last entry setting it
+	for i, sl := range p.lines {
+		used[sl.addr] = i
+	}
+	if start < 0 {
+		for _, sl := range p.lines {
+			if sl.addr >= start {
+				start = sl.addr + 1
+			}
+		}
+		if ref := p.stats().highestRef; ref >= start {
+			start = ref + 1
+		}
+	}
+
+	placed := make(map[int32]int32) // constant to the line holding it
+	next := start
+	for _, c := range consts {
+		addr, ok := placed[c.value]
+		if !ok {
+			for next < words {
+				if _, ok := used[next]; !ok {
+					break
+				}
+				next++
+			}
+			if next >= words {
+				return fmt.Errorf("%v: %d needed from line %d", poolOverflow, countDistinct(consts), start)
+			}
+			addr, next = next, next+1
+			placed[c.value] = addr
+			p.mem[addr] = c.value
+			p.lines = append(p.lines, sourceLine{line: p.lines[c.line].line, addr: addr, word: c.value, text: fmt.Sprintf("NUM %d", c.value)})
+		}
+
+		sl := &p.lines[c.line]
+		sl.inst.data = addr
+		sl.word = sl.inst.toInt32()
+		if used[sl.addr] == c.line {
+			p.mem[sl.addr] = sl.word
+		}
+	}
+
+	return nil
+}
+
+// countDistinct returns the number of different constants in consts.
+func countDistinct(consts []constRef) int {
+	seen := make(map[int32]bool)
+	for _, c := range consts {
+		seen[c.value] = true
+	}
+
+	return len(seen)
+}
+
+// collectLabels finds the address of every label in the source lines.
+// Lines with bad addresses are skipped; assembly reports them later.
+func collectLabels(lines []string) (map[string]int32, error) {
+	labels := make(map[string]int32)
+
+	var (
+		next    int32
+		pending []string
+	)
+	for i, line := range lines {
+		label, rest := splitLabel(line)
+		if label != "" {
+			if _, ok := labels[label]; ok || contains(pending, label) {
+				return nil, fmt.Errorf("error on line %d: %v %q", i+1, duplicateLabel, label)
+			}
+			pending = append(pending, label)
+		}
+		if _, ok := directive(rest, ".entry"); ok || rest == "" {
+			continue
+		}
+		if _, ok := directive(rest, ".pool"); ok {
+			continue
+		}
+
+		addrField := strings.SplitN(withAddress(rest, next), " ", 2)[0]
+		if strings.Contains(rest, ":") {
+			addrField = strings.SplitN(rest, ":", 2)[0]
+		}
+		addr, err := strconv.ParseUint(addrField, 10, 32)
+		if err != nil || addr >= words {
+			continue
+		}
+
+		for _, l := range pending {
+			labels[l] = int32(addr)
+		}
+		pending = nil
+		next = int32(addr) + 1
+	}
+
+	for _, l := range pending {
+		if next >= words {
+			return nil, fmt.Errorf("%v %q", badLabelAddress, l)
+		}
+		labels[l] = next
+	}
+
+	return labels, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitLabel separates a leading "label:" from the rest of a line, after
+// removing any comment. Comments run from a ";" to the end of the line.
+func splitLabel(line string) (string, string) {
+	if i := strings.Index(line, ";"); i >= 0 {
+		line = line[:i]
+	}
+
+	i := strings.Index(line, ":")
+	if i <= 0 || !isLabel(line[:i]) {
+		return "", strings.TrimSpace(line)
+	}
+
+	return line[:i], strings.TrimSpace(line[i+1:])
+}
+
+// isLabel reports whether s can be used as a label: an identifier that
+// isn't also a mnemonic.
+func isLabel(s string) bool {
+	if isMnemonic(s) || s == "" {
+		return false
+	}
+
+	for i, r := range s {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// directive returns the argument of line if it is the directive name.
+func directive(line, name string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != name {
+		return "", false
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(line, name)), true
+}
+
+// sourceMap maps each store line the program sets to the source line it
+// was assembled from. Later entries for the same address win, as they do in
+// the store.
+func (p *program) sourceMap() map[int32]int {
+	m := make(map[int32]int, len(p.lines))
+	for _, sl := range p.lines {
+		m[sl.addr] = sl.line
+	}
+
+	return m
+}
+
+// resolveLabels replaces a label operand in an addressed line of code with
+// the label's address.
+func (p *program) resolveLabels(code string) (string, error) {
+	parts := strings.SplitN(code, " ", 3)
+	if len(parts) < 3 || !isLabel(parts[2]) {
+		return code, nil
+	}
+
+	addr, ok := p.labels[parts[2]]
+	if !ok {
+		return "", fmt.Errorf("%v %q", unknownLabel, parts[2])
+	}
+
+	return fmt.Sprintf("%s %s %d", parts[0], parts[1], addr), nil
+}
+
+// resolveAddress returns the address named by s, either a label or a
+// decimal store line.
+func (p *program) resolveAddress(s string) (int32, error) {
+	if addr, ok := p.labels[s]; ok {
+		return addr, nil
+	}
+	if isLabel(s) {
+		return 0, fmt.Errorf("%v %q", unknownLabel, s)
+	}
+
+	addr, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || addr >= words {
+		return 0, badAddress
+	}
+
+	return int32(addr), nil
+}
+
+// programStats summarises the makeup of a program.
+type programStats struct {
+	opcodes    [STP + 1]int // instructions using each function number
+	data       int          // data words
+	highestRef int32        // highest store line used as an operand, -1 if none
+}
+
+func (p *program) stats() programStats {
+	st := programStats{highestRef: -1}
+
+	for _, sl := range p.lines {
+		if sl.inst == nil {
+			st.data++
+			continue
+		}
+
+		st.opcodes[sl.inst.op]++
+		switch sl.inst.op {
+		case CMP, STP:
+		default:
+			if sl.inst.data > st.highestRef {
+				st.highestRef = sl.inst.data
+			}
+		}
+	}
+
+	return st
+}
+
+// writeListing writes an assembler listing for the program to w: one line
+// per source entry followed by a summary footer.
+func (p *program) writeListing(w io.Writer) error {
+	var sb strings.Builder
+
+	for _, sl := range p.lines {
+		bin := EncodeWord(sl.word)
+		code := fmt.Sprintf("NUM %d", sl.word)
+		if sl.inst != nil {
+			code = sl.inst.String()
+		}
+		fmt.Fprintf(&sb, "%04d:%s | %-12s ; line %d\n", sl.addr, bin, code, sl.line)
+	}
+
+	st := p.stats()
+	var ops []string
+	for op, n := range st.opcodes {
+		if n > 0 {
+			ops = append(ops, fmt.Sprintf("%s %d", opNames[op], n))
+		}
+	}
+	fmt.Fprintln(&sb)
+	fmt.Fprintf(&sb, "opcodes: %s\n", strings.Join(ops, ", "))
+	fmt.Fprintf(&sb, "data words: %d\n", st.data)
+	fmt.Fprintf(&sb, "highest referenced address: %d\n", st.highestRef)
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeOpcodes writes the instruction encoding table to w: each mnemonic,
+// its function number and the function bits as stored, least significant
+// first, in bits 13 to 15 of the word.
+func writeOpcodes(w io.Writer) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%-8s %-8s %s\n", "mnemonic", "function", "bits 13-15")
+	for op, name := range opNames {
+		fmt.Fprintf(&sb, "%-8s %-8d %d%d%d\n", name, op, op&1, op>>1&1, op>>2&1)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// disassemble returns assembly for word w, without an address. Words that
+// don't reassemble to exactly the same value are written as NUM data.
+func disassemble(w int32) string {
+	code := instFromWord(w).String()
+	if _, inst, err := instructionFromCode("0 " + code); err == nil && inst.toInt32() == w {
+		return code
+	}
+
+	return fmt.Sprintf("NUM %d", w)
+}
+
+// forEachNonZero calls fn with the address, word and decoded instruction
+// of every non-zero word in the store, in address order.
+func (m *memory) forEachNonZero(fn func(addr int32, raw int32, inst *instruction)) {
+	for addr, w := range m {
+		if w != 0 {
+			fn(int32(addr), w, instFromWord(w))
+		}
+	}
+}
+
+// ToAssembly returns an assembly program that reproduces the store. Zero
+// words are omitted as they are the loader's default.
+func (m *memory) ToAssembly() string {
+	var sb strings.Builder
+
+	m.forEachNonZero(func(addr, w int32, _ *instruction) {
+		fmt.Fprintf(&sb, "%04d %s\n", addr, disassemble(w))
+	})
+
+	return sb.String()
+}
+
+// ToBinary returns the store in the binary form the loader reads, one
+// "NNNN:bits" line per word. As with ToAssembly, zero words are omitted.
+func (m *memory) ToBinary() string {
+	return m.toBinary(false)
+}
+
+// ToFullBinary returns the store in the same form as ToBinary, but with a
+// line for every word, zeros included, so the output is a complete store
+// image that diffs cleanly.
+func (m *memory) ToFullBinary() string {
+	return m.toBinary(true)
+}
+
+func (m *memory) toBinary(full bool) string {
+	var sb strings.Builder
+
+	for addr, w := range m {
+		if full || w != 0 {
+			fmt.Fprintf(&sb, "%04d:%s\n", addr, EncodeWord(w))
+		}
+	}
+
+	return sb.String()
+}
+
+// ToListing returns a self-documenting program that reproduces the store:
+// the assembly for each word with its binary encoding alongside as a
+// comment. Zero words are omitted.
+func (m *memory) ToListing() string {
+	var sb strings.Builder
+
+	sb.WriteString("; Manchester Baby program: assembly, with each word's binary encoding\n")
+	m.forEachNonZero(func(addr, w int32, _ *instruction) {
+		fmt.Fprintf(&sb, "%04d %-12s ; %04d:%s\n", addr, disassemble(w), addr, EncodeWord(w))
+	})
+
+	return sb.String()
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProgramStats(t *testing.T) {
+	data, err := os.ReadFile("test.baby")
+	if err != nil {
+		t.Fatalf("reading test.baby: %v", err)
+	}
+	p, err := assemble(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("assemble: unexpected error: %v", err)
+	}
+
+	want := programStats{highestRef: 16, data: 6}
+	want.opcodes[JMP] = 1
+	want.opcodes[JRP] = 1
+	want.opcodes[LDN] = 3
+	want.opcodes[STO] = 1
+	want.opcodes[SUB] = 1
+	want.opcodes[CMP] = 2
+	want.opcodes[STP] = 1
+	if got := p.stats(); got != want {
+		t.Errorf("stats() = %+v, want %+v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := p.writeListing(&buf); err != nil {
+		t.Fatalf("writeListing: unexpected error: %v", err)
+	}
+	for _, s := range []string{
+		"0001:10110000000000100000000000000000 | LDN 13       ; line 1\n",
+		"opcodes: JMP 1, JRP 1, LDN 3, STO 1, SUB 1, CMP 2, STP 1\n",
+		"data words: 6\n",
+		"highest referenced address: 16\n",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("listing missing %q:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestStatsBinary(t *testing.T) {
+	src := "0001:00000000000000110000000000000000\n0002:00000000000000000000000000000000\n0003:00000000000001110000000000000000\n0004:10000000000000000000000000000001\n"
+	p, err := assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("assemble: unexpected error: %v", err)
+	}
+
+	st := p.stats()
+	if st.opcodes[CMP] != 1 || st.opcodes[STP] != 1 || st.data != 2 || st.highestRef != -1 {
+		t.Errorf("stats() = %+v, want 1 CMP, 1 STP, 2 data words, no references", st)
+	}
+}
+
+func TestToAssembly(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+	mem[20] = (&instruction{op: SUB2, data: 3}).toInt32()
+	mem[21] = (&instruction{op: CMP, data: 3}).toInt32()
+
+	got, err := loadProgramFromReader(strings.NewReader(mem.ToAssembly()))
+	if err != nil {
+		t.Fatalf("reloading assembly: unexpected error: %v", err)
+	}
+	if got != mem {
+		t.Errorf("round trip = %v, want %v", got, mem)
+	}
+}
+
+func TestSUB2RoundTrip(t *testing.T) {
+	w := (&instruction{op: SUB2, data: 7}).toInt32()
+	if got := disassemble(w); got != "SUB2 7" {
+		t.Errorf("disassemble(%d) = %q, want %q", w, got, "SUB2 7")
+	}
+
+	_, inst, err := instructionFromCode("0001 " + disassemble(w))
+	if err != nil || inst.op != SUB2 || inst.toInt32() != w {
+		t.Errorf("reassembled to %v, %v, want function %d and word %d", inst, err, SUB2, w)
+	}
+	if got := disassemble((&instruction{op: SUB, data: 7}).toInt32()); got != "SUB 7" {
+		t.Errorf("function 4 disassembled to %q, want %q", got, "SUB 7")
+	}
+}
+
+func TestWriteOpcodes(t *testing.T) {
+	var out strings.Builder
+	if err := writeOpcodes(&out); err != nil {
+		t.Fatalf("writeOpcodes: unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != STP+2 {
+		t.Fatalf("got %d lines, want a header and %d functions:\n%s", len(lines), STP+1, out.String())
+	}
+	for op, name := range opNames {
+		// The bits match the word's encoding: LSB first from bit 13.
+		bits := EncodeWord((&instruction{op: int32(op)}).toInt32())[13:16]
+		if got, want := strings.Fields(lines[op+1]), []string{name, fmt.Sprint(op), bits}; !reflect.DeepEqual(got, want) {
+			t.Errorf("function %d: got %v, want %v", op, got, want)
+		}
+	}
+}
+
+func TestToBinary(t *testing.T) {
+	mem, err := loadProgram("primes.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+	mem[31] = -1
+
+	a := assembler{strict: true}
+	p, err := a.assemble(strings.NewReader(mem.ToBinary()))
+	if err != nil {
+		t.Fatalf("reloading binary: unexpected error: %v", err)
+	}
+	if p.mem != mem {
+		t.Errorf("round trip = %v, want %v", p.mem, mem)
+	}
+}
+
+func TestEmptyProgram(t *testing.T) {
+	cases := []struct {
+		src     string
+		wantErr error
+	}{
+		{"", emptyProgram},
+		{"\n\n   \n", emptyProgram},
+		{"; nothing here yet\n   ; or here\n", emptyProgram},
+		{"; a lone stop\n0001 STP\n", nil},
+		{"0000:00000000000000000000000000000000\n", nil},
+	}
+
+	for i, tc := range cases {
+		if _, err := assembleFile(writeProgram(t, tc.src)); err != tc.wantErr {
+			t.Errorf("case %d: got(%v) != want(%v)", i, err, tc.wantErr)
+		}
+	}
+
+	if _, err := (assembler{}).assembleInline(" ; ;"); err != emptyProgram {
+		t.Errorf("empty inline program: got(%v) != want(%v)", err, emptyProgram)
+	}
+}
+
+func TestAssembleInline(t *testing.T) {
+	cases := []struct {
+		src     string
+		want    map[int32]int32
+		wantErr string
+	}{
+		{"0010 LDN 21;0011 STP", map[int32]int32{10: 16405, 11: 57344}, ""},
+		{"start: LDN a; STP ;a: NUM -4", map[int32]int32{0: 16386, 1: 57344, 2: -4}, ""},
+		{"0010 LDN 21;0011 LDN", nil, "error on line 2"},
+	}
+
+	for i, tc := range cases {
+		p, err := assembler{}.assembleInline(tc.src)
+		if tc.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				t.Errorf("case %d: got error(%v) != want(%s...)", i, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		var want memory
+		for addr, w := range tc.want {
+			want[addr] = w
+		}
+		if p.mem != want {
+			t.Errorf("case %d: got(%v) != want(%v)", i, p.mem, want)
+		}
+	}
+}
+
+func TestToFullBinary(t *testing.T) {
+	mem := loopMem()
+	full := mem.ToFullBinary()
+
+	lines := strings.Split(strings.TrimSuffix(full, "\n"), "\n")
+	if len(lines) != words {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), words, full)
+	}
+	for i, l := range lines {
+		if want := fmt.Sprintf("%04d:%s", i, EncodeWord(mem[i])); l != want {
+			t.Errorf("line %d: got(%q) != want(%q)", i, l, want)
+		}
+	}
+
+	p, err := assemble(strings.NewReader(full))
+	if err != nil {
+		t.Fatalf("reloading full binary: unexpected error: %v", err)
+	}
+	if p.mem != mem {
+		t.Errorf("round trip = %v, want %v", p.mem, mem)
+	}
+}
+
+func TestToListing(t *testing.T) {
+	for _, f := range []string{"test.baby", "primes.baby", "medieval_analog_clock.baby"} {
+		mem, err := loadProgram(f)
+		if err != nil {
+			t.Fatalf("loadProgram(%q): unexpected error: %v", f, err)
+		}
+		mem[31] = math.MinInt32
+
+		listing := mem.ToListing()
+		got, err := loadProgramFromReader(strings.NewReader(listing))
+		if err != nil {
+			t.Fatalf("%s: reloading listing: unexpected error: %v", f, err)
+		}
+		if got != mem {
+			t.Errorf("%s: round trip = %v, want %v", f, got, mem)
+		}
+		if !strings.Contains(listing, "; 0031:00000000000000000000000000000001\n") {
+			t.Errorf("%s: listing missing the binary comment for line 31:\n%s", f, listing)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	src := `; A program with comments.
+0001 LDN 5 ; load -n
+here: ; the label isn't a comment
+0002 STP
+0005:11000000000000000000000000000000 ; 3, in binary: with a colon
+`
+	p, err := assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("assemble: unexpected error: %v", err)
+	}
+
+	var want memory
+	want[1] = (&instruction{op: LDN, data: 5}).toInt32()
+	want[2] = (&instruction{op: STP}).toInt32()
+	want[5] = 3
+	if p.mem != want {
+		t.Errorf("mem = %v, want %v", p.mem, want)
+	}
+	if p.labels["here"] != 2 {
+		t.Errorf("label here = %d, want 2", p.labels["here"])
+	}
+}
+
+func TestStrictAssembly(t *testing.T) {
+	cases := []struct {
+		input   string
+		wantErr error
+	}{
+		{"0001:11011000000000100000000010000000\n", nil},
+		{"0001 LDN 31\n0002 STP\n0003 NUM 12345\n", nil},
+		{"0001:1101100000000010000000001\n", badLength},
+		{"0001:110110000000001000000000100000000\n", badMemory},
+		{"0001 LDN 32\n", badRange},
+		{"0001 JMP -1\n", badRange},
+	}
+
+	for i, tc := range cases {
+		if _, err := assemble(strings.NewReader(tc.input)); tc.wantErr != badMemory && err != nil {
+			t.Errorf("case %d: non-strict assemble: unexpected error: %v", i, err)
+		}
+
+		_, err := assembler{strict: true}.assemble(strings.NewReader(tc.input))
+		if (err == nil) != (tc.wantErr == nil) || (err != nil && !strings.Contains(err.Error(), tc.wantErr.Error())) {
+			t.Errorf("case %d: err(%v) != wantErr(%v)", i, err, tc.wantErr)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	src := `
+a:     NUM 7
+b:     NUM 3
+start: LDN a
+       SUB b
+       STO out
+       STP
+out:
+`
+	p, err := assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("assemble: unexpected error: %v", err)
+	}
+
+	want := map[string]int32{"a": 0, "b": 1, "start": 2, "out": 6}
+	if !reflect.DeepEqual(p.labels, want) {
+		t.Errorf("labels = %v, want %v", p.labels, want)
+	}
+	if p.entry != 2 {
+		t.Errorf("entry = %d, want 2", p.entry)
+	}
+	if got, want := p.mem[4], (&instruction{op: STO, data: 6}).toInt32(); got != want {
+		t.Errorf("STO out assembled to %d, want %d", got, want)
+	}
+}
+
+func TestEntryPoint(t *testing.T) {
+	cases := []struct {
+		src     string
+		wantACC int32
+	}{
+		{"NUM 7\nNUM 3\nstart: LDN 0\nSTP\n", -7},
+		{".entry main\nNUM 7\nNUM 3\nmain: LDN 1\nSTP\n", -3},
+		{".entry 3\n0001 LDN 10\n0002 STP\n0003 LDN 11\n0004 STP\n0010 NUM 4\n0011 NUM 5\n", -5},
+		{"0001 LDN 10\n0002 STP\n0010 NUM 4\n", -4},
+	}
+
+	for i, tc := range cases {
+		p, err := assemble(strings.NewReader(tc.src))
+		if err != nil {
+			t.Fatalf("case %d: assemble: unexpected error: %v", i, err)
+		}
+
+		b := newBabyFromProgram(p)
+		for b.running {
+			if _, err := b.Step(); err != nil {
+				t.Fatalf("case %d: step: unexpected error: %v", i, err)
+			}
+		}
+		if b.Accumulator() != tc.wantACC || b.cycles != 2 {
+			t.Errorf("case %d: acc(%d) != want(%d) || cycles(%d) != 2", i, b.Accumulator(), tc.wantACC, b.cycles)
+		}
+
+		// Reset returns to the entry point.
+		b.Reset()
+		b.Step()
+		if b.Accumulator() != tc.wantACC {
+			t.Errorf("case %d: after Reset acc(%d) != want(%d)", i, b.Accumulator(), tc.wantACC)
+		}
+	}
+}
+
+func TestLabelErrors(t *testing.T) {
+	cases := []struct {
+		src     string
+		wantErr error
+	}{
+		{"LDN nowhere\n", unknownLabel},
+		{"a: NUM 1\na: NUM 2\n", duplicateLabel},
+		{".entry nowhere\nSTP\n", unknownLabel},
+		{".entry 32\nSTP\n", badAddress},
+		{"0031 STP\nend:\n", badLabelAddress},
+	}
+
+	for i, tc := range cases {
+		_, err := assemble(strings.NewReader(tc.src))
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr.Error()) {
+			t.Errorf("case %d: err(%v) != wantErr(%v)", i, err, tc.wantErr)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	cases := []struct {
+		src  string
+		want map[int32]int32 // store line to its word
+	}{
+		// Constants follow the highest line set or referred to, and
+		// repeats share a word.
+		{"LDN =1000\nSUB =-5\nSTO 20\nLDN =1000\nSTP\n", map[int32]int32{
+			0:  (&instruction{op: LDN, data: 21}).toInt32(),
+			1:  (&instruction{op: SUB, data: 22}).toInt32(),
+			3:  (&instruction{op: LDN, data: 21}).toInt32(),
+			21: 1000,
+			22: -5,
+		}},
+		// A pool starts where .pool says, skipping lines already set.
+		{".pool consts\nLDN =7\nSUB =8\nSTP\nconsts: NUM 1\n", map[int32]int32{
+			0: (&instruction{op: LDN, data: 4}).toInt32(),
+			1: (&instruction{op: SUB, data: 5}).toInt32(),
+			3: 1,
+			4: 7,
+			5: 8,
+		}},
+		{".pool 30\n0001 LDN =2147483647\n0002 STP\n", map[int32]int32{
+			1:  (&instruction{op: LDN, data: 30}).toInt32(),
+			30: 2147483647,
+		}},
+	}
+
+	for i, tc := range cases {
+		p, err := assemble(strings.NewReader(tc.src))
+		if err != nil {
+			t.Fatalf("case %d: assemble: unexpected error: %v", i, err)
+		}
+		for addr, want := range tc.want {
+			if got := p.mem[addr]; got != want {
+				t.Errorf("case %d: line %d: got(%d) != want(%d)", i, addr, got, want)
+			}
+		}
+	}
+
+	// The constants are loaded as data.
+	p, err := assemble(strings.NewReader("NUM 0\nLDN =-1000\nSUB =24\nSTO 3\nSTP\n"))
+	if err != nil {
+		t.Fatalf("assemble: unexpected error: %v", err)
+	}
+	b := newBabyFromProgram(p)
+	for b.running {
+		if _, err := b.Step(); err != nil {
+			t.Fatalf("step: unexpected error: %v", err)
+		}
+	}
+	if b.mem[3] != 976 {
+		t.Errorf("mem[3] = %d, want 976", b.mem[3])
+	}
+}
+
+func TestConstantErrors(t *testing.T) {
+	cases := []struct {
+		src     string
+		wantErr error
+	}{
+		{".pool 30\nLDN =1\nSUB =2\nSUB =3\nSTP\n", poolOverflow},
+		{"0028 LDN =1\n0029 SUB =2\n0030 STO 31\n", poolOverflow},
+		{".pool 32\nLDN =1\n", badAddress},
+		{".pool nowhere\nLDN =1\n", unknownLabel},
+		{"LDN =x\n", badOperand},
+		{"LDN =2147483648\n", badData},
+		{"NUM =1\n", badOperand},
+	}
+
+	for i, tc := range cases {
+		_, err := assemble(strings.NewReader(tc.src))
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr.Error()) {
+			t.Errorf("case %d: err(%v) != wantErr(%v)", i, err, tc.wantErr)
+		}
+	}
+}
+
+func TestEcho(t *testing.T) {
+	src := "; add two numbers\nstart: LDN a\n0001 SUB =2\nSTP\na: NUM 3\n"
+
+	var out strings.Builder
+	if _, err := (assembler{echo: &out}).assemble(strings.NewReader(src)); err != nil {
+		t.Fatalf("assemble: unexpected error: %v", err)
+	}
+
+	want := []string{
+		"   2: LDN a                    => 0000:11000000000000100000000000000000 16387",
+		"   4: STP                      => 0002:00000000000001110000000000000000 57344",
+		"   5: NUM 3                    => 0003:11000000000000000000000000000000 3",
+		"   3: 0001 SUB =2              => 0001:00100000000000010000000000000000 32772",
+		"   3: NUM 2                    => 0004:01000000000000000000000000000000 2",
+	}
+	if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("echoed:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Lines before an error are still echoed.
+	out.Reset()
+	if _, err := (assembler{echo: &out}).assemble(strings.NewReader("STP\nLDN\n")); err == nil {
+		t.Fatalf("assemble succeeded, want error")
+	}
+	if got := strings.Count(out.String(), "\n"); got != 1 {
+		t.Errorf("echoed %d lines before the error, want 1:\n%s", got, out.String())
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// concurrentAccess is returned by RaceCheck if the machine has been used
+// from more than one goroutine at once. Nothing in it is locked.
+var (
+	concurrentAccess = errors.New("invalid use - machine used from more than one goroutine")
+	alreadyRunning   = errors.New("invalid run - a run started by RunAsync is still going")
+)
+
+// asyncRun tracks a run started by RunAsync.
+type asyncRun struct {
+	done     chan struct{} // closed once the run has stopped
+	stop     chan struct{} // closed to ask the run to stop
+	stopOnce sync.Once
+	err      error // why the run stopped; only read once done is closed
+}
+
+// OnHalt sets fn to be called each time a run, from Run or RunAsync,
+// comes to an end. A nil fn removes the hook.
+func (b *baby) OnHalt(fn func()) {
+	b.onHalt = fn
+}
+
+// halted calls the OnHalt hook, if there is one.
+func (b *baby) halted() {
+	if b.onHalt != nil {
+		b.onHalt()
+	}
+}
+
+// RunAsync runs the machine in a new goroutine, without display, until it
+// stops or Stop is called. The machine mustn't otherwise be used until
+// WaitForHalt reports that the run has ended. It returns alreadyRunning,
+// and starts nothing, while an earlier run is still going.
+func (b *baby) RunAsync() error {
+	if r := b.async; r != nil {
+		select {
+		case <-r.done:
+		default:
+			return alreadyRunning
+		}
+	}
+
+	r := &asyncRun{done: make(chan struct{}), stop: make(chan struct{})}
+	b.async = r
+
+	go func() {
+		defer close(r.done)
+		defer b.releaseAccess()
+		defer b.halted()
+
+		for b.running {
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+			if _, err := b.Step(); err != nil {
+				r.err = err
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop asks a run started by RunAsync to stop after its current step.
+// Use WaitForHalt to wait for it to do so.
+func (b *baby) Stop() {
+	if r := b.async; r != nil {
+		r.stopOnce.Do(func() { close(r.stop) })
+	}
+}
+
+// WaitForHalt blocks until the run started by RunAsync ends or ctx is
+// done. It returns nil when the machine stopped normally, the error that
+// stopped it otherwise, or ctx.Err() if ctx finished first. Without a run
+// in progress it returns nil straight away.
+func (b *baby) WaitForHalt(ctx context.Context) error {
+	r := b.async
+	if r == nil {
+		return nil
+	}
+
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunAsync(t *testing.T) {
+	b := NewBaby(breakMem())
+	halts := 0
+	b.OnHalt(func() { halts++ })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	b.RunAsync()
+	if err := b.WaitForHalt(ctx); err != nil {
+		t.Fatalf("WaitForHalt() = %v, want nil", err)
+	}
+	if b.running || b.cycles != 4 || halts != 1 {
+		t.Errorf("running(%t), cycles(%d), halts(%d), want false, 4, 1", b.running, b.cycles, halts)
+	}
+
+	// Waiting again, or without a run, returns at once.
+	if err := b.WaitForHalt(ctx); err != nil {
+		t.Errorf("second WaitForHalt() = %v, want nil", err)
+	}
+	if err := NewBaby(breakMem()).WaitForHalt(ctx); err != nil {
+		t.Errorf("WaitForHalt() without a run = %v, want nil", err)
+	}
+}
+
+func TestRunAsyncError(t *testing.T) {
+	var mem memory
+	mem[1] = (&instruction{op: JMP, data: 2}).toInt32()
+	mem[2] = 40
+
+	b := NewBaby(mem)
+	b.RunAsync()
+	if err := b.WaitForHalt(context.Background()); err != badCI {
+		t.Errorf("WaitForHalt() = %v, want %v", err, badCI)
+	}
+}
+
+func TestRunAsyncCancel(t *testing.T) {
+	b := NewBaby(loopMem()) // Never stops.
+	if err := b.RunAsync(); err != nil {
+		t.Fatalf("RunAsync() = %v, want nil", err)
+	}
+	first := b.async
+	if err := b.RunAsync(); err != alreadyRunning || b.async != first {
+		t.Errorf("second RunAsync() = %v, replaced run(%t), want %v and the first run kept", err, b.async != first, alreadyRunning)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.WaitForHalt(ctx); err != context.DeadlineExceeded {
+		t.Errorf("WaitForHalt() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	b.Stop()
+	b.Stop() // Stopping twice is harmless.
+	if err := b.WaitForHalt(context.Background()); err != nil {
+		t.Errorf("WaitForHalt() after Stop = %v, want nil", err)
+	}
+	if !b.running || b.cycles == 0 {
+		t.Errorf("running(%t), cycles(%d): want a machine stopped part way", b.running, b.cycles)
+	}
+
+	// Once the run has ended another can start.
+	if err := b.RunAsync(); err != nil {
+		t.Errorf("RunAsync() after the first run ended = %v, want nil", err)
+	}
+	b.Stop()
+	b.WaitForHalt(context.Background())
+}
+
+func TestRunOnHalt(t *testing.T) {
+	b := NewBaby(breakMem())
+	b.ConnectTerminal(strings.NewReader(""), &strings.Builder{})
+	halts := 0
+	b.OnHalt(func() { halts++ })
+
+	b.Run()
+	if halts != 1 {
+		t.Errorf("OnHalt called %d times, want 1", halts)
+	}
+}
@@ -9,9 +9,11 @@ package main
 // * https://www.icsa.inf.ed.ac.uk/research/groups/hase/models/ssem/index.html
 
 import (
+	"bufio"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math/bits"
 	"os"
@@ -22,8 +24,41 @@ import (
 
 var (
 	programfile = flag.String("programfile", "", "path to program file")
+	inlineProg  = flag.String("program", "", "a program given inline with ';' between lines, run or listed instead of -programfile")
+	detectLoop  = flag.Bool("detect-loop", false, "stop when the machine repeats an earlier state")
+	restoreFile = flag.String("restore", "", "path to a saved machine state to start from instead of a program (aliases -load-state, -resume)")
+	outputFile  = flag.String("output", "", "path to save the machine state to on quit (alias -save-state)")
+	strict      = flag.Bool("strict", false, "reject binary words that aren't 32 bits and operands outside the store")
+	listing     = flag.Bool("listing", false, "print an assembler listing of the program and exit")
+	echo        = flag.Bool("echo", false, "print each program line to stderr as it loads, with the store line it was placed on and the word it assembled to")
+	asmCheck    = flag.Bool("asm-check", false, "assemble and lint the program without running it, exiting non-zero on any problem")
+	headless    = flag.Bool("headless", false, "run the program to completion without display and exit")
+	maxSteps    = flag.Int64("max-steps", 0, "stop after this many steps (0 for no limit)")
+	castFile    = flag.String("cast", "", "path to write an asciicast recording of the display during runs to, with frames a step delay apart")
+	plotFile    = flag.String("plot", "", "path to write a CSV of the accumulator after each step to on exit")
+	compareFile = flag.String("compare", "", "path to a program whose store must match the final store (implies -headless)")
+	suiteDir    = flag.String("suite", "", "path to a directory of .asm, .bin and .baby programs to run headless, each compared with a .expected store of the same name")
+	diffFile    = flag.String("diff", "", "path to a program to compare the initial store of -programfile with; prints the lines that differ and exits")
+	opcodes     = flag.Bool("opcodes", false, "print the instruction encoding table and exit")
+	historyFile = flag.String("history", "", "path to a file the REPL's command history is read from at startup and saved to on quit")
+	heatmap     = flag.Bool("heatmap", false, "colour the store in the display by how often each line has executed")
+	accAddr     = flag.Bool("acc-address", false, "show the store line the accumulator refers to, as an address, beside the registers")
+	invertDots  = flag.Bool("invert-dots", false, "draw 0 bits as lit dots and 1 bits as dark, as some references show the tube")
+	fullStore   = flag.Bool("full", false, "write all 32 words, zeros included, when dumping the store in binary")
+	showVersion = flag.Bool("version", false, "print version information and exit")
+	traceFmt    = flag.String("trace-format", "text", "how the T command writes trace lines: text (tab separated) or json (an object per line)")
+	traceOps    traceOpList // -trace-op, registered in init as it repeats
+	timing      = flag.String("timing", "flat", "how simulated time is counted: flat (700 instructions a second) or accurate (store scans per opcode)")
+	calcExpr    = flag.String("calc", "", "evaluate an expression of integers added and subtracted on the machine, print the result and exit")
 )
 
+func init() {
+	flag.StringVar(restoreFile, "load-state", "", "path to a saved machine state to start from instead of a program (aliases -restore, -resume)")
+	flag.StringVar(restoreFile, "resume", "", "path to a saved machine state to continue running from instead of a program (aliases -restore, -load-state)")
+	flag.Var(&traceOps, "trace-op", "only trace steps executing this instruction, such as SUB; repeat for more than one")
+	flag.StringVar(outputFile, "save-state", "", "path to save the machine state to on quit (alias -output)")
+}
+
 const (
 	words = 32 // The machine has this many address locations
 )
@@ -40,16 +75,54 @@ const (
 	STP         // Stop (7; 111 in LSB first)
 )
 
-var opNames = []string{"JMP", "JRP", "LDN", "STO", "SUB", "SUB", "CMP", "STP"}
+// Function numbers 4 and 5 both subtract. They get distinct names so that
+// disassembly reassembles to the same encoding.
+var opNames = []string{"JMP", "JRP", "LDN", "STO", "SUB", "SUB2", "CMP", "STP"}
 var nameOps = map[string]int32{
-	"JMP": JMP,
-	"JRP": JRP,
-	"LDN": LDN,
-	"STO": STO,
-	"SUB": SUB,
-	// SUB2
-	"CMP": CMP,
-	"STP": STP,
+	"JMP":  JMP,
+	"JRP":  JRP,
+	"LDN":  LDN,
+	"STO":  STO,
+	"SUB":  SUB,
+	"SUB2": SUB2,
+	"CMP":  CMP,
+	"STP":  STP,
+}
+
+// pseudoOp assembles the operand of a pseudo-op into the word it stores.
+type pseudoOp func(operand string) (int32, error)
+
+// pseudoOps are the mnemonics that store data rather than an instruction.
+// None may share a name with an entry in nameOps.
+var pseudoOps = map[string]pseudoOp{
+	"NUM": numOp,
+}
+
+// numOp stores its operand, a decimal number, as is.
+func numOp(operand string) (int32, error) {
+	v, err := parseDecimal(operand)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, badData
+	}
+	if err != nil {
+		return 0, badOperand
+	}
+
+	return v, nil
+}
+
+// parseDecimal parses an operand that must fit in a word. Like addresses,
+// it is always base 10: leading zeros don't make "022" octal.
+func parseDecimal(s string) (int32, error) {
+	v, err := strconv.ParseInt(s, 10, 32)
+	return int32(v), err
+}
+
+// isMnemonic reports whether s names an instruction or a pseudo-op.
+func isMnemonic(s string) bool {
+	_, op := nameOps[s]
+	_, pseudo := pseudoOps[s]
+	return op || pseudo
 }
 
 type instruction struct {
@@ -71,6 +144,26 @@ func (i *instruction) String() string {
 	return sb.String()
 }
 
+// Describe explains in plain English what executing inst would do.
+func Describe(inst *instruction) string {
+	switch inst.op {
+	case JMP:
+		return fmt.Sprintf("jump: set ci to the word in store line %d, so execution continues from the line after it", inst.data)
+	case JRP:
+		return fmt.Sprintf("relative jump: add the word in store line %d to ci", inst.data)
+	case LDN:
+		return fmt.Sprintf("load the negative of store line %d into the accumulator", inst.data)
+	case STO:
+		return fmt.Sprintf("store the accumulator in store line %d", inst.data)
+	case SUB, SUB2:
+		return fmt.Sprintf("subtract store line %d from the accumulator", inst.data)
+	case CMP:
+		return "skip the next instruction if the accumulator is negative"
+	default:
+		return "stop the machine"
+	}
+}
+
 func (i *instruction) toInt32() int32 {
 	return 0 | (i.op << 13) | i.data
 }
@@ -95,58 +188,620 @@ func (m *memory) RawWord(i int) uint32 {
 	return bits.Reverse32(uint32(m[i]))
 }
 
+// EncodeWord returns val as the machine writes it: 32 binary digits, least
+// significant bit first.
+func EncodeWord(val int32) string {
+	return fmt.Sprintf("%032s", strconv.FormatUint(uint64(bits.Reverse32(uint32(val))), 2))
+}
+
+// DecodeWord is the inverse of EncodeWord, taking binary digits least
+// significant bit first. As in the binary program format, fewer than 32
+// digits are taken to be the last digits of the word, as if padded on the
+// left with zeros.
+func DecodeWord(s string) (int32, error) {
+	i, err := strconv.ParseUint(s, 2, 32)
+	if err != nil {
+		return 0, badMemory
+	}
+
+	return int32(bits.Reverse32(uint32(i))), nil
+}
+
+// rotateWord rotates the bits of w n places to the right as the Baby
+// displays them, least significant bit first; that is, towards the more
+// significant end. Bits shifted off one end reappear at the other. A
+// negative n rotates to the left.
+func rotateWord(w int32, n int) int32 {
+	return int32(bits.RotateLeft32(uint32(w), n))
+}
+
 type baby struct {
 	mem     memory
 	ci, acc register // registers (ci == pc -> program counter, acc == accumulator)
 	running bool
+	cycles  int64 // steps executed since the last reset
+
+	maxSteps  int64         // steps allowed before stopping; 0 for no limit
+	stepDelay time.Duration // pause between steps in Run
+	sleeper   Sleeper
+	displayN  int // Run draws the machine every displayN steps; 0 for never
+	timing    timingModel
+	beats     int64 // store scans taken by the steps since the last reset
+
+	initialMem memory   // store as originally loaded, restored on reboot
+	initialCI  register // ci value restored by Reset; one before the start address
+	initialACC register // acc value restored by Reset
+
+	source map[int32]int    // store line to source line; nil if unknown
+	labels map[string]int32 // the program's labels; nil if unknown
+
+	last     int32        // store line of the most recently executed instruction
+	lastInst *instruction // the most recently executed instruction; nil before the first step
+
+	addrCounts  [words]int64 // times each line was executed since the last reset
+	readCounts  [words]int64 // times each line was read as an operand since the last reset
+	writeCounts [words]int64 // times each line was stored to since the last reset
+
+	history       []HistoryEntry // state before each recent step, oldest first
+	historyDepth  int
+	historyPolicy HistoryPolicy // evicts history in place of historyDepth when set
+	trace         io.Writer     // receives a line per step when non-nil
+	traceFormat   traceFormat
+	traceOps      map[int32]bool // opcodes traced; nil for all
+
+	loops *loopDetector // nil unless loop detection is enabled
+
+	breakpoints map[int32]bool
+	watchpoints map[int32]watchKind
+	bitWatches  map[int32]uint32 // mask of the watched bits of each line
+	protected   [words]bool      // lines STO may not write to
+	annotations map[int32]string // user notes on store lines
+	atBreak     bool             // stopped at the breakpoint on the next instruction
+
+	verbose     bool   // whether Step keeps lastExplain, for StepVerbose
+	lastExplain string // ExplainStep of the step being executed
+
+	checkpointN int // steps between checkpoints; 0 for none
+	checkpoints []checkpoint
+
+	breakConds []func(*baby) bool
+	paused     bool // stopped by a break condition until Resume
+
+	haltConds  []haltCondition
+	haltReason HaltReason // why the machine last stopped
+	haltMsg    string     // message of the halt condition that stopped it
+	lastError  error      // why ci left the store, for HaltAddressError
+
+	recordACC bool // whether accLog is kept
+	accLog    []accSample
+
+	stepHook     StepHook
+	memWriteHook MemWriteHook
+	breakHook    BreakHook
+	hooksEnabled bool      // whether the step and store write hooks run
+	onHalt       func()    // called when a run ends
+	async        *asyncRun // the run started by RunAsync, if any
+	owner        raceOwner // which goroutines stepped the machine, with the debug tag
+
+	in   *bufio.Reader // interactive input; stdin when nil
+	tty  bool          // whether in is a terminal to read with editLine
+	out  io.Writer     // interactive output; stdout when nil
+	rows int           // terminal height for the display; 0 shows everything
+	cast *castRecorder // records the frames Run draws; nil if not recording
+	cmds *commandHistory
+
+	fullDump    bool // whether D writes zero words too
+	heatmap     bool // whether the display colours the store by execution count
+	invertDots  bool // whether the display lights 0 bits rather than 1s
+	showAccAddr bool // whether the display shows the line acc refers to
 }
 
+// NewBaby returns a machine with mem in its store and everything else at
+// its defaults. See NewWithConfig for setting more up front.
 func NewBaby(mem memory) *baby {
-	return &baby{running: true, mem: mem}
+	return NewWithConfig(BabyConfig{Memory: mem})
 }
 
 func (b *baby) Display() {
-	fmt.Println("\033[H\033[2J")
-	fmt.Printf("ci: %d, acc: %d, running: %t\n", b.ci, b.acc, b.running)
-	for row := 0; row < words; row++ {
-		rw := b.mem.RawWord(row)
-		i := instFromWord(b.mem[row])
-		ind := ""
-		if row == int(b.ci) {
-			ind = " <=="
+	b.DisplayTo(b.writer())
+}
+
+// DisplayTo redraws the registers and a picture of the store on w, in
+// place of the previous picture.
+func (b *baby) DisplayTo(w io.Writer) {
+	fmt.Fprint(w, cursorHome)
+	for _, l := range b.screenLines(b.rows) {
+		fmt.Fprint(w, l, clearLine, "\n")
+	}
+	fmt.Fprint(w, clearBelow)
+}
+
+// FormatInstruction describes the word at addr on a single line: its bits,
+// its value in hex, the instruction it decodes to and, for instructions
+// that use the store, the word their operand refers to. An empty string is
+// returned for an address outside the store.
+func (b *baby) FormatInstruction(addr int32) string {
+	if addr < 0 || addr >= words {
+		return ""
+	}
+
+	return b.formatInstruction(addr, instFromWord(b.mem[addr]))
+}
+
+// formatInstruction is FormatInstruction for the word at addr, already
+// decoded to i.
+func (b *baby) formatInstruction(addr int32, i *instruction) string {
+	w := b.mem[addr]
+	s := fmt.Sprintf("%04d: %s | 0x%08X | %s", addr, EncodeWord(w), uint32(w), i)
+	switch i.op {
+	case CMP, STP:
+	default:
+		s += fmt.Sprintf(" | [mem[%d]=%d]", i.data, b.mem[i.data])
+	}
+	if b.breakpoints[addr] {
+		s += " | breakpoint"
+	}
+	if note := b.annotations[addr]; note != "" {
+		s += " | " + note
+	}
+
+	return s
+}
+
+// AnnotatedDump returns FormatInstruction for every line of the store.
+func (b *baby) AnnotatedDump() string {
+	var sb strings.Builder
+
+	b.ForEachInstruction(func(addr int32, inst *instruction) {
+		sb.WriteString(b.formatInstruction(addr, inst))
+		sb.WriteString("\n")
+	})
+
+	return sb.String()
+}
+
+// ForEachInstruction calls fn with the address and decoded instruction of
+// every word in the store, in address order. Data words are decoded like
+// any other.
+func (b *baby) ForEachInstruction(fn func(addr int32, inst *instruction)) {
+	for addr := int32(0); addr < words; addr++ {
+		fn(addr, instFromWord(b.mem[addr]))
+	}
+}
+
+// ForEachNonZero is like ForEachInstruction, but skips zero words and also
+// passes fn the raw word.
+func (b *baby) ForEachNonZero(fn func(addr int32, raw int32, inst *instruction)) {
+	b.mem.forEachNonZero(fn)
+}
+
+// MapMemory returns a copy of the store with each word replaced by fn of
+// its address and value. The machine's own store is left unchanged.
+func (b *baby) MapMemory(fn func(addr int32, word int32) int32) memory {
+	var m memory
+	for addr, w := range b.mem {
+		m[addr] = fn(int32(addr), w)
+	}
+
+	return m
+}
+
+// FilterMemory returns the addresses, in order, whose words satisfy pred.
+func (b *baby) FilterMemory(pred func(addr int32, word int32) bool) []int32 {
+	var addrs []int32
+	for addr, w := range b.mem {
+		if pred(int32(addr), w) {
+			addrs = append(addrs, int32(addr))
 		}
+	}
+
+	return addrs
+}
+
+// WordCount returns how many words of the store decode to function op,
+// data words included. It counts the program as stored, not as run.
+func (b *baby) WordCount(op int32) int {
+	return len(b.FilterMemory(func(addr, word int32) bool { return instFromWord(word).op == op }))
+}
 
-		s := fmt.Sprintf("%032s", strconv.FormatInt(int64(rw), 2))
-		s = strings.ReplaceAll(strings.ReplaceAll(s, "0", "."), "1", "#")
-		fmt.Printf("%04d:%32s | %4s [%-8s ; %12d]\n", row, s, ind, i, b.mem[row])
+// AccumulatorBinary returns the accumulator as 32 binary digits, least
+// significant bit first, the way the Baby displays it.
+func (b *baby) AccumulatorBinary() string {
+	return EncodeWord(int32(b.acc))
+}
+
+// SetMaxSteps limits the number of steps executed between resets. Once the
+// limit is reached the machine stops and Step returns tooManySteps. A limit
+// of 0 removes the restriction.
+func (b *baby) SetMaxSteps(n int64) {
+	b.maxSteps = n
+}
+
+// SetDisplayInterval makes Run draw the machine only every n steps rather
+// than after each one. Run always draws the machine once it stops, so an
+// interval of 0 (or less) shows only the final state.
+func (b *baby) SetDisplayInterval(n int) {
+	if n < 0 {
+		n = 0
 	}
-	fmt.Println()
+	b.displayN = n
+}
+
+// clone returns an independent copy of the machine that doesn't write a
+// trace or detect loops.
+func (b *baby) clone() *baby {
+	c := *b
+	c.history = append([]HistoryEntry(nil), b.history...)
+	c.trace = nil
+	c.loops = nil
+	c.stepHook, c.memWriteHook, c.onHalt, c.async = nil, nil, nil, nil
+	c.breakHook, c.breakConds, c.paused = nil, nil, false
+	c.owner = raceOwner{}
+	return &c
+}
+
+// CycleCount returns the number of steps executed since the last reset.
+func (b *baby) CycleCount() int64 {
+	return b.cycles
+}
+
+// CycleCountSince returns the number of steps executed since CycleCount
+// returned mark, like time.Since. It is negative if the machine was reset
+// or stepped back in between.
+func (b *baby) CycleCountSince(mark int64) int64 {
+	return b.cycles - mark
+}
+
+// RegisterSnapshot is a copy of the machine's registers at one moment.
+type RegisterSnapshot struct {
+	CI, ACC int32
+	Running bool
+	Cycle   int64
+}
+
+// RegisterState returns a snapshot of the registers.
+func (b *baby) RegisterState() RegisterSnapshot {
+	return RegisterSnapshot{CI: int32(b.ci), ACC: int32(b.acc), Running: b.running, Cycle: b.cycles}
+}
+
+// SimulateStep returns the registers as they would be after the next
+// step, without changing the machine.
+func (b *baby) SimulateStep() RegisterSnapshot {
+	c := b.clone()
+	c.SetHistoryDepth(0)
+	c.Step()
+
+	return c.RegisterState()
+}
+
+// ProbeSnapshot is a copy of the registers and a chosen set of store words
+// at one moment.
+type ProbeSnapshot struct {
+	CI, ACC int32
+	Cycle   int64
+	Words   map[int32]int32 // store address to word
+}
+
+// Probe returns the registers and the words at addrs taken together, so
+// that all of them come from between the same two steps. Addresses outside
+// the store are left out. Like Step, it takes no lock: during RunAsync it
+// may only be called from the machine's own hooks, such as the step hook,
+// and builds with the debug tag report any other use through RaceCheck.
+func (b *baby) Probe(addrs []int32) ProbeSnapshot {
+	b.noteAccess()
+
+	p := ProbeSnapshot{CI: int32(b.ci), ACC: int32(b.acc), Cycle: b.cycles, Words: make(map[int32]int32, len(addrs))}
+	for _, addr := range addrs {
+		if addr >= 0 && addr < words {
+			p.Words[addr] = b.mem[addr]
+		}
+	}
+
+	return p
+}
+
+// ProgramCounter returns the current value of ci.
+func (b *baby) ProgramCounter() int32 {
+	return int32(b.ci)
+}
+
+// SetCI sets ci to v. As ci is incremented before each fetch, the next
+// step executes the instruction at v+1.
+func (b *baby) SetCI(v int32) {
+	b.ci = register(v)
+}
+
+// PeekMem returns the word at addr.
+func (b *baby) PeekMem(addr int32) (int32, error) {
+	if addr < 0 || addr >= words {
+		return 0, badAddress
+	}
+
+	return b.mem[addr], nil
+}
+
+// PokeMem sets the word at addr to value, returning the previous word.
+func (b *baby) PokeMem(addr, value int32) (int32, error) {
+	if addr < 0 || addr >= words {
+		return 0, badAddress
+	}
+
+	old := b.mem[addr]
+	b.mem[addr] = value
+	b.memWritten(addr, old, value)
+	return old, nil
+}
+
+// SetStartAddress makes addr the first instruction executed after a
+// Reset. The start address is kept across Reboot but not Clear.
+func (b *baby) SetStartAddress(addr int32) error {
+	if addr < 0 || addr >= words {
+		return badAddress
+	}
+
+	b.initialCI = register(addr - 1)
+	return nil
+}
+
+// newBabyFromProgram returns a machine ready to run the assembled program
+// p from its entry point.
+func newBabyFromProgram(p *program) *baby {
+	b := NewBaby(p.mem)
+	b.source, b.labels = p.sourceMap(), p.labels
+	if p.entry >= 0 {
+		b.SetStartAddress(p.entry)
+		b.Reset()
+	}
+
+	return b
+}
+
+// LoadProgram replaces the original program with the one in path and
+// reboots into it, starting from its entry point if it gives one.
+func (b *baby) LoadProgram(path string) error {
+	p, err := assembleFile(path)
+	if err != nil {
+		return err
+	}
+
+	b.load(p)
+	return nil
+}
+
+// CompileAndLoad assembles src and, like LoadProgram, reboots into it. If
+// src doesn't assemble, or has no entries, the machine is left as it was.
+func (b *baby) CompileAndLoad(src string) error {
+	p, err := assembler{}.assembleProgram(strings.NewReader(src))
+	if err != nil {
+		return err
+	}
+
+	b.load(p)
+	return nil
+}
+
+// LoadAndRun loads the program in path as LoadProgram does and runs it
+// with RunN(maxSteps), returning the registers once it stops.
+func (b *baby) LoadAndRun(path string, maxSteps int) (RegisterSnapshot, error) {
+	if err := b.LoadProgram(path); err != nil {
+		return RegisterSnapshot{}, err
+	}
+
+	err := b.RunN(maxSteps)
+	return b.RegisterState(), err
+}
+
+// load makes p the original program and reboots into it.
+func (b *baby) load(p *program) {
+	b.initialCI = 0
+	if p.entry >= 0 {
+		b.SetStartAddress(p.entry)
+	}
+	b.initialMem = p.mem
+	b.Reboot(p.mem)
+	b.source, b.labels = p.sourceMap(), p.labels
+}
+
+// Accumulator returns the current value of the accumulator.
+func (b *baby) Accumulator() int32 {
+	return int32(b.acc)
+}
+
+// SourceLine returns the line of the program source that the word on
+// store line addr was assembled from, or 0 if it isn't known.
+func (b *baby) SourceLine(addr int32) int {
+	return b.source[addr]
+}
+
+// sourceError adds the source line of the most recently executed
+// instruction to err, which is a runtime error returned by Step.
+func (b *baby) sourceError(err error) error {
+	if err == nil || b.cycles == 0 {
+		return err
+	}
+	if line := b.SourceLine(b.last); line > 0 {
+		return fmt.Errorf("%w (source line %d)", err, line)
+	}
+
+	return err
+}
+
+// SetInitialACC sets the value the accumulator takes on Reset, for
+// programs that expect a pre-loaded accumulator. It is cleared by Reboot.
+func (b *baby) SetInitialACC(v int32) {
+	b.initialACC = register(v)
 }
 
 func (b *baby) Reboot(mem memory) {
 	b.mem = mem
+	b.initialACC = 0
 	b.Reset()
 }
 
+// RebootOriginal reboots with the store as it was originally loaded,
+// undoing any changes the program or user made to it.
+func (b *baby) RebootOriginal() {
+	b.Reboot(b.initialMem)
+}
+
+// Clear zeroes the entire store and the registers, leaving a blank
+// machine.
+func (b *baby) Clear() {
+	b.initialCI = 0
+	b.source, b.labels = nil, nil
+	b.Reboot(memory{})
+}
+
 func (b *baby) Reset() {
-	b.ci = 0
-	b.acc = 0
+	b.ci = b.initialCI
+	b.acc = b.initialACC
 	b.running = true
+	b.cycles = 0
+	b.beats = 0
+	b.addrCounts = [words]int64{}
+	b.readCounts = [words]int64{}
+	b.writeCounts = [words]int64{}
+	b.history = nil
+	b.accLog = nil
+	b.lastInst = nil
+	b.clearHalt()
+	b.paused, b.atBreak = false, false
+	if b.loops != nil {
+		b.loops.reset()
+	}
+	b.CheckpointEvery(b.checkpointN)
+}
+
+// NextStep returns the address the next step will execute and the
+// instruction it will decode there, without changing the machine. It
+// returns -1 and nil if the next address is outside the store, when Step
+// would fail with badCI.
+func (b *baby) NextStep() (int32, *instruction) {
+	next := int32(b.ci + 1)
+	if next < 0 || next >= words {
+		return -1, nil
+	}
+
+	return next, instFromWord(b.mem[next])
 }
 
-func (b *baby) Step() {
+// ExplainStep describes what the next step will do with the machine as it
+// is now, register and store values included, such as "0002 JMP 6: CI =
+// store line 6 (3), continuing from line 4". It returns an empty string if
+// the next address is outside the store.
+func (b *baby) ExplainStep() string {
+	addr, inst := b.NextStep()
+	if inst == nil {
+		return ""
+	}
+
+	return b.explain(addr, inst)
+}
+
+// StepVerbose is Step, returning the ExplainStep description of the step
+// it executed, taken as it executed. If the step fails the error is
+// returned as text instead.
+func (b *baby) StepVerbose() string {
+	b.verbose = true
+	defer func() { b.verbose = false }()
+
+	b.lastExplain = ""
+	if _, err := b.Step(); err != nil {
+		return b.sourceError(err).Error()
+	}
+
+	return b.lastExplain
+}
+
+// explain describes executing inst from store line addr.
+func (b *baby) explain(addr int32, inst *instruction) string {
+	s := fmt.Sprintf("%04d %s: ", addr, inst)
+	v := b.mem[inst.data]
+	switch inst.op {
+	case JMP:
+		s += fmt.Sprintf("CI = store line %d (%d), continuing from line %d", inst.data, v, v+1)
+	case JRP:
+		s += fmt.Sprintf("CI = CI (%d) + store line %d (%d), continuing from line %d", addr, inst.data, v, addr+v+1)
+	case LDN:
+		s += fmt.Sprintf("ACC = -store line %d (%d) = %d", inst.data, v, -v)
+	case STO:
+		s += fmt.Sprintf("store line %d (%d) = ACC (%d)", inst.data, v, b.acc)
+	case SUB, SUB2:
+		s += fmt.Sprintf("ACC = ACC (%d) - store line %d (%d) = %d", b.acc, inst.data, v, b.acc-register(v))
+	case CMP:
+		if b.acc < 0 {
+			s += fmt.Sprintf("ACC (%d) is negative, so CI = %d, skipping line %d", b.acc, addr+1, addr+1)
+		} else {
+			s += fmt.Sprintf("ACC (%d) isn't negative, so line %d runs next", b.acc, addr+1)
+		}
+	default:
+		s += "stop the machine"
+	}
+
+	return s
+}
+
+// LastStep returns the address the most recent step executed, before any
+// jump it made, and the instruction it decoded there. It returns -1 and
+// nil before the first step after a reset.
+func (b *baby) LastStep() (int32, *instruction) {
+	if b.lastInst == nil {
+		return -1, nil
+	}
+
+	return b.last, b.lastInst
+}
+
+// Step executes a single machine cycle and returns the decoded
+// instruction that was executed. If the next instruction address falls
+// outside the store, as after a jump to a bad address, nothing is executed:
+// the machine stops with HaltAddressError and badCI is returned, and kept
+// for LastError.
+func (b *baby) Step() (*instruction, error) {
+	b.noteAccess()
+
+	if b.paused {
+		return nil, breakPaused
+	}
+
+	if b.maxSteps > 0 && b.cycles >= b.maxSteps {
+		b.halt(HaltMaxSteps, "")
+		return nil, tooManySteps
+	}
+
 	// The Baby increments the ci (current instruction) counter
 	// prior to loading the instruction, not after executing from
 	// the current value.
-	b.ci += 1
+	if next := b.ci + 1; next < 0 || next >= words {
+		b.halt(HaltAddressError, "")
+		b.lastError = badCI
+		return nil, badCI
+	}
 
-	inst := instFromWord(b.mem[b.ci])
-	fmt.Println(inst)
+	if b.atBreakpoint() {
+		return nil, breakpointHit
+	}
+
+	inst := instFromWord(b.mem[b.ci+1])
+	if inst.op == STO && b.protected[inst.data] {
+		return inst, fmt.Errorf("%w: store to line %d", protectedStore, inst.data)
+	}
+	if b.verbose {
+		b.lastExplain = b.explain(int32(b.ci+1), inst)
+	}
+	before := b.mem[inst.data]
+	b.cycles++
+	b.beats += opBeats[inst.op]
+	b.record(inst)
+	b.ci += 1
+	b.last, b.lastInst = int32(b.ci), inst
+	b.addrCounts[b.last]++
+	b.countAccess(inst, 1)
 
 	switch inst.op {
 	case JMP:
 		b.ci = register(b.mem[inst.data])
-	case SUB:
+	case SUB, SUB2:
 		b.acc = b.acc - register(b.mem[inst.data])
 	case CMP:
 		if b.acc < 0 {
@@ -157,21 +812,82 @@ func (b *baby) Step() {
 	case JRP:
 		b.ci = b.ci + register(b.mem[inst.data])
 	case STO:
+		old := b.mem[inst.data]
 		b.mem[inst.data] = int32(b.acc)
+		b.memWritten(inst.data, old, int32(b.acc))
 	case STP:
-		b.running = false
+		b.halt(HaltStop, "")
+	}
+
+	if b.recordACC {
+		b.accLog = append(b.accLog, accSample{b.cycles, b.acc, b.ci})
+	}
+	b.stepped(inst)
+	if b.running {
+		b.checkHaltConditions()
+	}
+	if b.running && b.breakConditionHit() {
+		b.paused = true
+		b.broke()
+	}
+	if b.checkpointN > 0 && b.cycles%int64(b.checkpointN) == 0 {
+		b.saveCheckpoint()
 	}
+
+	if err := b.watchHit(inst, before); err != nil {
+		return inst, err
+	}
+
+	if b.loops != nil && b.running && b.loops.observe(b.stateHash()) {
+		b.halt(HaltLoop, "")
+		return inst, livelock
+	}
+	if b.paused {
+		return inst, breakConditionMet
+	}
+
+	return inst, nil
+}
+
+// RunN runs the machine without display until it stops or a step fails.
+// With n above 0 it gives up with tooManySteps if the machine is still
+// running after n steps; any limit set by SetMaxSteps applies either way.
+// Errors are reported against the program source, as Run reports them.
+func (b *baby) RunN(n int) error {
+	start := b.cycles
+	for b.running {
+		if n > 0 && b.cycles-start >= int64(n) {
+			return tooManySteps
+		}
+		if _, err := b.Step(); err != nil {
+			return b.sourceError(err)
+		}
+	}
+
+	return nil
 }
 
 func (b *baby) Run() {
+	defer b.halted()
+
 	for {
-		b.Display()
 		if !b.running {
+			b.frame()
+			if b.haltReason == HaltCondition {
+				fmt.Fprintln(b.writer(), "halted:", b.haltMsg)
+			}
 			break
 		}
+		if b.displayN > 0 && b.cycles%int64(b.displayN) == 0 {
+			b.frame()
+		}
 
-		b.Step()
-		time.Sleep(time.Millisecond) // This is short. ~1.2 ms per instruction.
+		if _, err := b.Step(); err != nil {
+			b.frame()
+			fmt.Fprintln(b.writer(), b.sourceError(err))
+			break
+		}
+		b.sleeper.Sleep(b.stepDelay)
 	}
 }
 
@@ -182,7 +898,10 @@ var (
 	badAddress     = errors.New("invalid address - unusable address")
 	badMemory      = errors.New("invalid binary code - couldn't convert to integer")
 	badOperand     = errors.New("invalid code - invalid operand")
+	badData        = errors.New("invalid code - data doesn't fit in a word")
 	badInstruction = errors.New("invalid code - unknown instruction")
+	badCI          = errors.New("invalid ci - instruction address out of range")
+	tooManySteps   = errors.New("invalid run - maximum steps exceeded")
 )
 
 func instructionFromCode(code string) (int32, *instruction, error) {
@@ -193,6 +912,23 @@ func instructionFromCode(code string) (int32, *instruction, error) {
 		return 0, nil, badAddress
 	}
 
+	if len(parts) < 2 {
+		return 0, nil, badInstruction
+	}
+
+	// Pseudo-ops store data, which we carry as the operand of a JMP: its
+	// function number is 0, so the word is just the data.
+	if pseudo, ok := pseudoOps[parts[1]]; ok {
+		if len(parts) < 3 {
+			return 0, nil, missingOp
+		}
+		w, err := pseudo(parts[2])
+		if err != nil {
+			return 0, nil, err
+		}
+		return int32(n), &instruction{op: JMP, data: w}, nil
+	}
+
 	switch parts[1] {
 	case "CMP", "STP":
 		if len(parts) > 2 {
@@ -204,17 +940,11 @@ func instructionFromCode(code string) (int32, *instruction, error) {
 			return 0, nil, missingOp
 		}
 
-		operand, err := strconv.Atoi(parts[2])
+		operand, err := parseDecimal(parts[2])
 		if err != nil {
 			return 0, nil, badOperand
 		}
 
-		// This is syntactic sugar for allowing the input of
-		// numbers. Special case it.
-		if parts[1] == "NUM" {
-			return int32(n), &instruction{op: JMP, data: int32(operand)}, nil
-		}
-
 		op, ok := nameOps[parts[1]]
 		if !ok {
 			return 0, nil, badInstruction
@@ -235,12 +965,12 @@ func memFromBin(code string) (int32, int32, error) {
 		return 0, 0, badAddress
 	}
 
-	i, err := strconv.ParseUint(parts[1], 2, 32)
+	w, err := DecodeWord(parts[1])
 	if err != nil {
-		return 0, 0, badMemory
+		return 0, 0, err
 	}
 
-	return int32(n), int32(bits.Reverse32(uint32(i))), nil
+	return int32(n), w, nil
 }
 
 // Function loadProgram takes a file path and reads a baby program from it.
@@ -250,64 +980,214 @@ func memFromBin(code string) (int32, int32, error) {
 // Binary format:
 // WORD#:32-bit Binary - 0000:00000110101001000100000100000100
 func loadProgram(programfile string) (memory, error) {
-	var mem memory
+	p, err := assembleFile(programfile)
+	if err != nil {
+		return memory{}, err
+	}
 
-	data, err := os.ReadFile(programfile)
+	return p.mem, nil
+}
+
+// Function loadProgramFromReader reads a baby program from r. Assembly
+// lines may omit their leading address, in which case they are placed on
+// the line after the previous entry (starting at line 0). An explicit
+// address relocates following implicit lines, much like .org. A program
+// with no entries is rejected with emptyProgram.
+func loadProgramFromReader(r io.Reader) (memory, error) {
+	p, err := assembler{}.assembleProgram(r)
 	if err != nil {
-		return mem, fmt.Errorf("error reading programfile: %v", err)
-	}
-
-	lines := strings.Split(string(data), "\n")
-
-	for i, line := range lines {
-		if line != "" {
-			if strings.Contains(line, ":") {
-				n, m, err := memFromBin(line)
-				if err != nil {
-					return mem, fmt.Errorf("error on line %d: %v", i+1, err)
-				}
-				mem[n] = m
-			} else {
-				n, inst, err := instructionFromCode(line)
-				if err != nil {
-					return mem, fmt.Errorf("error on line %d: %v", i+1, err)
-				}
-				mem[n] = inst.toInt32()
-			}
-		}
+		return memory{}, err
+	}
+
+	return p.mem, nil
+}
+
+// withAddress prefixes code with the address next if it starts directly
+// with a mnemonic rather than an explicit address.
+func withAddress(code string, next int32) string {
+	first := strings.SplitN(code, " ", 2)[0]
+	if isMnemonic(first) {
+		return fmt.Sprintf("%04d %s", next, code)
 	}
 
-	return mem, nil
+	return code
 }
 
 func main() {
+	if code, ok := dispatchCommand(os.Args[1:], os.Stdout, os.Stderr); ok {
+		os.Exit(code)
+	}
+
+	flag.Usage = usage
 	flag.Parse()
 
-	mem, err := loadProgram(*programfile)
+	if *showVersion {
+		writeVersion(os.Stdout)
+		os.Exit(0)
+	}
+
+	if *opcodes {
+		if err := writeOpcodes(os.Stdout); err != nil {
+			log.Fatalf("Couldn't write opcodes: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	if *calcExpr != "" {
+		v, err := calculate(*calcExpr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		fmt.Println(v)
+		os.Exit(exitOK)
+	}
+
+	asm := assembler{strict: *strict}
+	if *echo {
+		asm.echo = os.Stderr
+	}
+	tm, err := parseTiming(*timing)
 	if err != nil {
-		log.Fatalf("Couldn't load program from %q: %v", *programfile, err)
+		log.Fatalf("Couldn't use timing %q: %v", *timing, err)
+	}
+	tf, err := parseTraceFormat(*traceFmt)
+	if err != nil {
+		log.Fatalf("Couldn't use trace format %q: %v", *traceFmt, err)
 	}
-	b := NewBaby(mem)
-	for {
-		b.Display()
-		fmt.Printf("(R)un, (S)tep, R(e)set, Re(b)oot, (Q)uit: ")
-		var input rune
 
-		_, err := fmt.Scanf("%c\n", &input)
+	if *asmCheck {
+		os.Exit(exitCode(checkProgram(asm, *inlineProg, *programfile, os.Stderr)))
+	}
+
+	if *listing {
+		p, err := asm.assembleSource(*inlineProg, *programfile)
 		if err != nil {
-			fmt.Println("Invalid input: ", err)
+			log.Fatalf("Couldn't load program from %q: %v", programName(), err)
 		}
-		switch input {
-		case 'R', 'r':
-			b.Run()
-		case 'S', 's':
-			b.Step()
-		case 'B', 'b':
-			b.Reboot(mem)
-		case 'E', 'e':
-			b.Reset()
-		case 'Q', 'q':
-			os.Exit(0)
+		if err := p.writeListing(os.Stdout); err != nil {
+			log.Fatalf("Couldn't write listing: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	if *diffFile != "" {
+		err := diffPrograms(asm, *inlineProg, *programfile, *diffFile, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(err))
+	}
+
+	if *suiteDir != "" {
+		err := runSuite(batchOptions{
+			asm:        asm,
+			maxSteps:   *maxSteps,
+			detectLoop: *detectLoop,
+			timing:     tm,
+		}, *suiteDir, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(err))
+	}
+
+	if *headless || *compareFile != "" {
+		err := runBatch(batchOptions{
+			asm:         asm,
+			programfile: *programfile,
+			program:     *inlineProg,
+			compare:     *compareFile,
+			maxSteps:    *maxSteps,
+			detectLoop:  *detectLoop,
+			timing:      tm,
+			plot:        *plotFile,
+		}, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(err))
+	}
+
+	var b *baby
+	if *restoreFile != "" {
+		var err error
+		b, err = loadStateFile(*restoreFile)
+		if err != nil {
+			log.Fatalf("Couldn't restore state from %q: %v", *restoreFile, err)
+		}
+	} else {
+		p, err := asm.assembleSource(*inlineProg, *programfile)
+		if err != nil {
+			log.Fatalf("Couldn't load program from %q: %v", programName(), err)
+		}
+		b = newBabyFromProgram(p)
+	}
+	b.SetLoopDetection(*detectLoop)
+	b.SetMaxSteps(*maxSteps)
+	b.SetTiming(tm)
+	b.SetTraceFormat(tf)
+	b.SetTraceOps(traceOps...)
+	b.RecordAccumulator(*plotFile != "")
+	b.rows = terminalRows()
+	b.fullDump = *fullStore
+	b.heatmap = *heatmap
+	b.invertDots = *invertDots
+	b.showAccAddr = *accAddr
+	if *castFile != "" {
+		f, err := os.Create(*castFile)
+		if err != nil {
+			log.Fatalf("Couldn't create recording %q: %v", *castFile, err)
+		}
+		if err := b.RecordCast(f, b.stepDelay); err != nil {
+			log.Fatalf("Couldn't write recording to %q: %v", *castFile, err)
+		}
+	}
+	if *historyFile != "" {
+		h, err := loadCommandHistory(*historyFile)
+		if err != nil {
+			log.Fatalf("Couldn't load command history from %q: %v", *historyFile, err)
+		}
+		b.cmds = h
+	}
+	if err := b.RunInteractive(); err != nil {
+		fmt.Println("Invalid input: ", err)
+	}
+	quit(b)
+}
+
+// programName returns how to refer to the program given on the command
+// line in messages.
+func programName() string {
+	return sourceName(*inlineProg, *programfile)
+}
+
+// sourceName returns how to refer to the inline program src, or the
+// program in path if src is empty, in messages.
+func sourceName(src, path string) string {
+	if src != "" {
+		return "-program"
+	}
+
+	return path
+}
+
+// quit saves the machine state if requested and exits.
+func quit(b *baby) {
+	if *historyFile != "" && b.cmds != nil {
+		if err := saveCommandHistory(b.cmds, *historyFile); err != nil {
+			log.Fatalf("Couldn't save command history to %q: %v", *historyFile, err)
+		}
+	}
+	if *outputFile != "" {
+		if err := saveStateFile(b, *outputFile); err != nil {
+			log.Fatalf("Couldn't save state to %q: %v", *outputFile, err)
+		}
+	}
+	if *plotFile != "" {
+		if err := writePlotFile(b, *plotFile); err != nil {
+			log.Fatalf("Couldn't write plot to %q: %v", *plotFile, err)
 		}
 	}
+	os.Exit(0)
 }
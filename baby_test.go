@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"math"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMemFromBin(t *testing.T) {
@@ -52,6 +58,18 @@ func TestInstructionFromCode(t *testing.T) {
 		{"0000 STO 2", 0, &instruction{op: STO, data: 2}, nil},
 		{"0031 STP", 31, &instruction{op: STP}, nil},
 		{"0023 NUM 10", 23, &instruction{op: JMP, data: 10}, nil},
+		{"0023 NUM -2147483648", 23, &instruction{op: JMP, data: math.MinInt32}, nil},
+
+		// Leading zeros, in operands as in addresses, are decimal.
+		{"0010 JMP 022", 10, &instruction{op: JMP, data: 22}, nil},
+		{"0010 JRP 010", 10, &instruction{op: JRP, data: 10}, nil},
+		{"0010 LDN 0031", 10, &instruction{op: LDN, data: 31}, nil},
+		{"0010 STO 08", 10, &instruction{op: STO, data: 8}, nil},
+		{"0010 SUB 0019", 10, &instruction{op: SUB, data: 19}, nil},
+		{"0010 NUM 0100", 10, &instruction{op: JMP, data: 100}, nil},
+		{"0010 NUM -010", 10, &instruction{op: JMP, data: -10}, nil},
+		{"0010 LDN 0x10", 0, nil, badOperand},
+		{"0010 LDN 2147483648", 0, nil, badOperand},
 
 		// Bad
 		{"000A JMP", 0, nil, badAddress},
@@ -66,6 +84,10 @@ func TestInstructionFromCode(t *testing.T) {
 		{"0000 JRP", 0, nil, missingOp},
 		{"0000 STO", 0, nil, missingOp},
 		{"0000 STP 21", 0, nil, extraOp},
+		{"0000 NUM", 0, nil, missingOp},
+		{"0000 NUM x", 0, nil, badOperand},
+		{"0000 NUM 2147483648", 0, nil, badData},
+		{"0000", 0, nil, badInstruction},
 
 		// Ugly
 		{"", 0, nil, badAddress},
@@ -82,3 +104,871 @@ func TestInstructionFromCode(t *testing.T) {
 		}
 	}
 }
+
+func TestPseudoOps(t *testing.T) {
+	for name := range pseudoOps {
+		if _, ok := nameOps[name]; ok {
+			t.Errorf("pseudo-op %s is also an instruction", name)
+		}
+		if isLabel(name) {
+			t.Errorf("pseudo-op %s can be used as a label", name)
+		}
+	}
+	for name := range nameOps {
+		if !isMnemonic(name) {
+			t.Errorf("instruction %s isn't a mnemonic", name)
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+	cases := []struct {
+		word    int32
+		acc     register
+		want    *instruction
+		wantCI  register
+		wantAcc register
+	}{
+		{(&instruction{op: JMP, data: 2}).toInt32(), 0, &instruction{op: JMP, data: 2}, 7, 0},
+		{(&instruction{op: JRP, data: 2}).toInt32(), 0, &instruction{op: JRP, data: 2}, 8, 0},
+		{(&instruction{op: LDN, data: 2}).toInt32(), 0, &instruction{op: LDN, data: 2}, 1, -7},
+		{(&instruction{op: STO, data: 3}).toInt32(), 5, &instruction{op: STO, data: 3}, 1, 5},
+		{(&instruction{op: SUB, data: 2}).toInt32(), 10, &instruction{op: SUB, data: 2}, 1, 3},
+		{(&instruction{op: SUB2, data: 2}).toInt32(), 10, &instruction{op: SUB2, data: 2}, 1, 3},
+		{(&instruction{op: CMP}).toInt32(), -1, &instruction{op: CMP}, 2, -1},
+		{(&instruction{op: CMP}).toInt32(), 1, &instruction{op: CMP}, 1, 1},
+		{(&instruction{op: STP}).toInt32(), 0, &instruction{op: STP}, 1, 0},
+	}
+
+	for i, tc := range cases {
+		var mem memory
+		mem[1] = tc.word
+		mem[2] = 7
+		b := NewBaby(mem)
+		b.acc = tc.acc
+
+		got, err := b.Step()
+		if err != nil || !reflect.DeepEqual(got, tc.want) || b.ci != tc.wantCI || b.acc != tc.wantAcc {
+			t.Errorf("case %d: got(%v) != want(%v) || ci(%d) != wantCI(%d) || acc(%d) != wantAcc(%d) || err(%v) != nil", i, got, tc.want, b.ci, tc.wantCI, b.acc, tc.wantAcc, err)
+		}
+	}
+}
+
+func TestStepOutOfRange(t *testing.T) {
+	var mem memory
+	b := NewBaby(mem)
+	b.ci = words - 1
+
+	got, err := b.Step()
+	if got != nil || err != badCI || b.running {
+		t.Errorf("got(%v) != nil || err(%v) != wantErr(%v) || running(%t) != false", got, err, badCI, b.running)
+	}
+}
+
+func TestLoadProgramFromReader(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    map[int32]int32
+		wantErr bool
+	}{
+		// Good
+		{"0001 LDN 5\n0002 STP\n", map[int32]int32{1: 0x4005, 2: 0xE000}, false},
+		{"LDN 5\nSTP\n", map[int32]int32{0: 0x4005, 1: 0xE000}, false},
+		{"0010 LDN 5\nSUB 6\nSTP\n", map[int32]int32{10: 0x4005, 11: 0x8006, 12: 0xE000}, false},
+		{"LDN 5\n0020 NUM 7\nNUM 8\n0003 STP\nCMP\n", map[int32]int32{0: 0x4005, 20: 7, 21: 8, 3: 0xE000, 4: 0xC000}, false},
+		{"0030:11100000000000000000000000000000\nNUM 9\n", map[int32]int32{30: 7, 31: 9}, false},
+		// Bad
+		{"0031 STP\nSTP\n", nil, true},
+		{"LDN\n", nil, true},
+		{"", nil, true},
+		{"; just a comment\n", nil, true},
+	}
+
+	for i, tc := range cases {
+		got, err := loadProgramFromReader(strings.NewReader(tc.input))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("case %d: err(%v), wantErr(%t)", i, err, tc.wantErr)
+			continue
+		}
+		if tc.wantErr {
+			continue
+		}
+
+		var want memory
+		for n, w := range tc.want {
+			want[n] = w
+		}
+		if got != want {
+			t.Errorf("case %d: got(%v) != want(%v)", i, got, want)
+		}
+	}
+}
+
+func TestLoadProgramSamples(t *testing.T) {
+	files, err := filepath.Glob("*.baby")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no sample programs found: %v", err)
+	}
+
+	for _, f := range files {
+		if _, err := loadProgram(f); err != nil {
+			t.Errorf("loadProgram(%q): unexpected error: %v", f, err)
+		}
+	}
+}
+
+func TestSetInitialACC(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.SetInitialACC(-5)
+	b.Step()
+	b.Reset()
+	if got := b.Accumulator(); got != -5 {
+		t.Errorf("after Reset: Accumulator() = %d, want -5", got)
+	}
+
+	b.Reboot(loopMem())
+	if b.initialACC != 0 {
+		t.Errorf("after Reboot: initialACC = %d, want 0", b.initialACC)
+	}
+	b.Reset()
+	if got := b.Accumulator(); got != 0 {
+		t.Errorf("after Reboot and Reset: Accumulator() = %d, want 0", got)
+	}
+}
+
+func TestClear(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.SetInitialACC(3)
+	b.Reset()
+	b.Step()
+	b.Clear()
+
+	if b.mem != (memory{}) || b.ci != 0 || b.acc != 0 || !b.running {
+		t.Errorf("mem(%v) != zero || ci(%d) != 0 || acc(%d) != 0 || running(%t) != true", b.mem, b.ci, b.acc, b.running)
+	}
+}
+
+func TestRebootOriginal(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+
+	b := NewBaby(mem)
+	for b.running {
+		b.Step()
+	}
+	b.PokeMem(0, 99)
+	if b.mem == mem {
+		t.Fatalf("running test.baby didn't change the store")
+	}
+
+	b.RebootOriginal()
+	if b.mem != mem || b.ci != 0 || b.acc != 0 || !b.running {
+		t.Errorf("RebootOriginal() left ci(%d), acc(%d), running(%t), store changed(%t)", b.ci, b.acc, b.running, b.mem != mem)
+	}
+}
+
+func TestCompileAndLoad(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.Step()
+
+	if err := b.CompileAndLoad("start: LDN a\nSTP\na: NUM -4\n"); err != nil {
+		t.Fatalf("CompileAndLoad: unexpected error: %v", err)
+	}
+	var want memory
+	want[0] = (&instruction{op: LDN, data: 2}).toInt32()
+	want[1] = (&instruction{op: STP}).toInt32()
+	want[2] = -4
+	if b.mem != want || b.initialMem != want || b.ci != -1 || b.cycles != 0 {
+		t.Errorf("after CompileAndLoad: ci(%d), cycles(%d), store:\n%s", b.ci, b.cycles, b.AnnotatedDump())
+	}
+
+	b.Step()
+	if err := b.CompileAndLoad("0001 LDN\n"); err == nil {
+		t.Fatalf("CompileAndLoad(bad) succeeded")
+	}
+	if b.mem != want || b.initialMem != want || b.ci != 0 || b.acc != 4 || b.cycles != 1 {
+		t.Errorf("failed CompileAndLoad changed the machine: ci(%d), acc(%d), cycles(%d)", b.ci, b.acc, b.cycles)
+	}
+
+	for _, src := range []string{"", "; nothing to run\n"} {
+		if err := b.CompileAndLoad(src); err != emptyProgram {
+			t.Errorf("CompileAndLoad(%q) = %v, want %v", src, err, emptyProgram)
+		}
+	}
+	if b.mem != want || b.ci != 0 || b.cycles != 1 {
+		t.Errorf("empty CompileAndLoad changed the machine: ci(%d), cycles(%d)", b.ci, b.cycles)
+	}
+}
+
+func TestAccumulatorBinary(t *testing.T) {
+	cases := []struct {
+		acc  register
+		want string
+	}{
+		{1, "10000000000000000000000000000000"},
+		{-1, "11111111111111111111111111111111"},
+		{0, "00000000000000000000000000000000"},
+		{math.MinInt32, "00000000000000000000000000000001"},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(memory{})
+		b.acc = tc.acc
+		if got := b.AccumulatorBinary(); got != tc.want {
+			t.Errorf("case %d: got(%q) != want(%q)", i, got, tc.want)
+		}
+
+		var buf bytes.Buffer
+		b.DisplayTo(&buf)
+		if !strings.Contains(buf.String(), tc.want) {
+			t.Errorf("case %d: DisplayTo output missing %q", i, tc.want)
+		}
+	}
+}
+
+func TestSetMaxSteps(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.SetMaxSteps(3)
+
+	for i := 0; i < 3; i++ {
+		if _, err := b.Step(); err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+	}
+	if _, err := b.Step(); err != tooManySteps || b.running {
+		t.Errorf("err(%v) != wantErr(%v) || running(%t) != false", err, tooManySteps, b.running)
+	}
+
+	b.Reset()
+	if _, err := b.Step(); err != nil {
+		t.Errorf("after Reset: unexpected error: %v", err)
+	}
+}
+
+func TestSimulateStep(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+
+	// test.baby exercises most opcodes before it stops.
+	b := NewBaby(mem)
+	seen := make(map[int32]bool)
+	for b.running {
+		before := b.mem
+		want := b.SimulateStep()
+		if b.mem != before || b.cycles != want.Cycle-1 {
+			t.Fatalf("SimulateStep modified the machine")
+		}
+
+		inst, _ := b.Step()
+		seen[inst.op] = true
+		if got := b.RegisterState(); got != want || want.CI != b.ProgramCounter() {
+			t.Errorf("%v: SimulateStep() = %+v, want %+v", inst, want, got)
+		}
+	}
+
+	if len(seen) < 5 {
+		t.Errorf("only %d distinct opcodes executed, want at least 5", len(seen))
+	}
+}
+
+func TestProbe(t *testing.T) {
+	var mem memory
+	for i := range mem {
+		mem[i] = int32(i * 10)
+	}
+	b := NewBaby(mem)
+	b.ci, b.acc, b.cycles = 3, -7, 12
+
+	got := b.Probe([]int32{5, 10, 15, -1, words})
+	want := map[int32]int32{5: 50, 10: 100, 15: 150}
+	if got.CI != 3 || got.ACC != -7 || got.Cycle != 12 {
+		t.Errorf("Probe() registers = %+v, want ci 3, acc -7, cycle 12", got)
+	}
+	if len(got.Words) != len(want) {
+		t.Errorf("Probe() returned %d words, want %d: %v", len(got.Words), len(want), got.Words)
+	}
+	for addr, w := range want {
+		if got.Words[addr] != w {
+			t.Errorf("Probe() word %d = %d, want %d", addr, got.Words[addr], w)
+		}
+	}
+}
+
+func TestEncodeDecodeWord(t *testing.T) {
+	cases := []struct {
+		val  int32
+		want string
+	}{
+		{0, "00000000000000000000000000000000"},
+		{1, "10000000000000000000000000000000"},
+		{-1, "11111111111111111111111111111111"},
+		{6, "01100000000000000000000000000000"},
+		{math.MaxInt32, "11111111111111111111111111111110"},
+		{math.MinInt32, "00000000000000000000000000000001"},
+		{math.MinInt32 + 1, "10000000000000000000000000000001"},
+		{16793627, "11011000000000100000000010000000"},
+	}
+
+	for i, tc := range cases {
+		got := EncodeWord(tc.val)
+		if got != tc.want {
+			t.Errorf("case %d: EncodeWord(%d) = %q, want %q", i, tc.val, got, tc.want)
+		}
+		back, err := DecodeWord(got)
+		if err != nil || back != tc.val {
+			t.Errorf("case %d: DecodeWord(%q) = %d, %v, want %d", i, got, back, err, tc.val)
+		}
+	}
+
+	for _, bad := range []string{"", "2", "111111111111111111111111111111111"} {
+		if _, err := DecodeWord(bad); err != badMemory {
+			t.Errorf("DecodeWord(%q): err(%v) != wantErr(%v)", bad, err, badMemory)
+		}
+	}
+}
+
+func TestFormatInstruction(t *testing.T) {
+	var mem memory
+	ops := []int32{JMP, JRP, LDN, STO, SUB, SUB2, CMP, STP}
+	for i, op := range ops {
+		mem[i] = (&instruction{op: op, data: 20}).toInt32()
+	}
+	mem[20] = 7
+
+	b := NewBaby(mem)
+	for i, op := range ops {
+		got := b.FormatInstruction(int32(i))
+		want := []string{
+			fmt.Sprintf("%04d: %s", i, EncodeWord(mem[i])),
+			fmt.Sprintf("0x%08X", mem[i]),
+			"| " + opNames[op],
+		}
+		switch op {
+		case CMP, STP:
+			if strings.Contains(got, "[mem[") {
+				t.Errorf("%s: %q references the store", opNames[op], got)
+			}
+		default:
+			want = append(want, "| [mem[20]=7]")
+		}
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: %q missing %q", opNames[op], got, w)
+			}
+		}
+	}
+
+	if got := b.FormatInstruction(words); got != "" {
+		t.Errorf("FormatInstruction(%d) = %q, want \"\"", words, got)
+	}
+	if got := strings.Count(b.AnnotatedDump(), "\n"); got != words {
+		t.Errorf("AnnotatedDump has %d lines, want %d", got, words)
+	}
+}
+
+func TestRotateWord(t *testing.T) {
+	cases := []struct {
+		w    int32
+		n    int
+		want string
+	}{
+		{1, 1, "01000000000000000000000000000000"},
+		{1, 31, "00000000000000000000000000000001"},
+		{1, 32, "10000000000000000000000000000000"},
+		{1, -1, "00000000000000000000000000000001"},
+		{math.MinInt32, 1, "10000000000000000000000000000000"},
+		{6, -1, "11000000000000000000000000000000"},
+		{0x4005, 3, "00010100000000000100000000000000"},
+		{-1, 7, "11111111111111111111111111111111"},
+	}
+
+	for i, tc := range cases {
+		if got := EncodeWord(rotateWord(tc.w, tc.n)); got != tc.want {
+			t.Errorf("case %d: rotateWord(%s, %d) = %s, want %s", i, EncodeWord(tc.w), tc.n, got, tc.want)
+		}
+	}
+}
+
+// fakeSleeper records the pauses asked for instead of taking them.
+type fakeSleeper struct {
+	pauses []time.Duration
+}
+
+func (s *fakeSleeper) Sleep(d time.Duration) { s.pauses = append(s.pauses, d) }
+
+func TestRun(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+
+	var outputs []string
+	for i := 0; i < 2; i++ {
+		s := &fakeSleeper{}
+		b := NewWithConfig(BabyConfig{Memory: mem, StepDelay: time.Second, Sleeper: s})
+		var out strings.Builder
+		b.ConnectTerminal(strings.NewReader(""), &out)
+
+		b.Run()
+		if b.running {
+			t.Fatalf("Run returned with the machine running")
+		}
+		if len(s.pauses) != int(b.cycles) || s.pauses[0] != time.Second {
+			t.Errorf("paused %d times (first %v), want %d times of 1s", len(s.pauses), s.pauses[0], b.cycles)
+		}
+		if got := strings.Count(out.String(), cursorHome); got != int(b.cycles)+1 {
+			t.Errorf("drew %d frames, want %d", got, b.cycles+1)
+		}
+		outputs = append(outputs, out.String())
+	}
+
+	if outputs[0] != outputs[1] {
+		t.Errorf("two runs of the same program drew different output")
+	}
+}
+
+func TestSetDisplayInterval(t *testing.T) {
+	cases := []struct {
+		interval   int
+		wantFrames int
+	}{
+		{1, 27},
+		// Before the first step, after steps 10 and 20, and on stopping.
+		{10, 4},
+		{30, 2},
+		{0, 1},
+		{-1, 1},
+	}
+
+	for i, tc := range cases {
+		b := NewWithConfig(BabyConfig{Memory: loopMem(), MaxSteps: 25, Sleeper: &fakeSleeper{}})
+		b.SetDisplayInterval(tc.interval)
+		var out strings.Builder
+		b.ConnectTerminal(strings.NewReader(""), &out)
+
+		b.Run()
+		if b.cycles != 25 {
+			t.Fatalf("case %d: ran %d steps, want 25", i, b.cycles)
+		}
+		if got := strings.Count(out.String(), cursorHome); got != tc.wantFrames {
+			t.Errorf("case %d: got(%d) != want(%d) frames", i, got, tc.wantFrames)
+		}
+	}
+}
+
+func TestForEachInstruction(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+	b := NewBaby(mem)
+
+	var addrs []int32
+	counts := make(map[int32]int)
+	b.ForEachInstruction(func(addr int32, inst *instruction) {
+		addrs = append(addrs, addr)
+		if addr >= 1 && addr <= 10 {
+			counts[inst.op]++
+		}
+	})
+
+	if len(addrs) != words {
+		t.Fatalf("called %d times, want %d", len(addrs), words)
+	}
+	for i, addr := range addrs {
+		if addr != int32(i) {
+			t.Errorf("call %d: got(%d) != want(%d)", i, addr, i)
+		}
+	}
+	// The code in lines 1 to 10 of test.baby.
+	want := map[int32]int{LDN: 3, SUB: 1, JRP: 1, STO: 1, CMP: 2, STP: 1, JMP: 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("opcode counts = %v, want %v", counts, want)
+	}
+}
+
+func TestForEachNonZero(t *testing.T) {
+	var five memory
+	five[1] = (&instruction{op: LDN, data: 20}).toInt32()
+	five[2] = (&instruction{op: STO, data: 21}).toInt32()
+	five[3] = (&instruction{op: STP}).toInt32()
+	five[20] = -7
+	five[31] = 1
+
+	cases := []struct {
+		mem       memory
+		wantAddrs []int32
+	}{
+		{memory{}, nil},
+		{five, []int32{1, 2, 3, 20, 31}},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(tc.mem)
+		var addrs []int32
+		b.ForEachNonZero(func(addr int32, raw int32, inst *instruction) {
+			addrs = append(addrs, addr)
+			if raw != tc.mem[addr] || *inst != *instFromWord(raw) {
+				t.Errorf("case %d: addr %d passed raw(%d) inst(%v), want %d", i, addr, raw, inst, tc.mem[addr])
+			}
+		})
+		if !reflect.DeepEqual(addrs, tc.wantAddrs) {
+			t.Errorf("case %d: got(%v) != want(%v)", i, addrs, tc.wantAddrs)
+		}
+	}
+}
+
+func TestLastStep(t *testing.T) {
+	b := NewBaby(breakMem())
+	if addr, inst := b.LastStep(); addr != -1 || inst != nil {
+		t.Errorf("before any steps LastStep() = %d, %v, want -1, nil", addr, inst)
+	}
+
+	// Running from line 0 executes the word there first.
+	b.SetCI(-1)
+	b.Step()
+	if addr, inst := b.LastStep(); addr != 0 || *inst != (instruction{op: JMP, data: 0}) {
+		t.Errorf("after the first step LastStep() = %d, %v, want 0, JMP 0", addr, inst)
+	}
+
+	cases := []struct {
+		wantAddr int32
+		wantInst instruction
+	}{
+		{1, instruction{op: LDN, data: 20}},
+		// The JMP is reported at its own address, not where it went.
+		{2, instruction{op: JMP, data: 21}},
+		{5, instruction{op: STO, data: 22}},
+	}
+	for i, tc := range cases {
+		b.Step()
+		if addr, inst := b.LastStep(); addr != tc.wantAddr || *inst != tc.wantInst {
+			t.Errorf("case %d: got(%d, %v) != want(%d, %v)", i, addr, inst, tc.wantAddr, &tc.wantInst)
+		}
+	}
+
+	b.StepBack()
+	if addr, inst := b.LastStep(); addr != 2 || *inst != cases[1].wantInst {
+		t.Errorf("after StepBack LastStep() = %d, %v, want 2, %v", addr, inst, &cases[1].wantInst)
+	}
+
+	b.Reset()
+	if addr, inst := b.LastStep(); addr != -1 || inst != nil {
+		t.Errorf("after Reset LastStep() = %d, %v, want -1, nil", addr, inst)
+	}
+}
+
+func TestNextStep(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+	b := NewBaby(mem)
+
+	for b.running {
+		addr, next := b.NextStep()
+		before := b.mem
+		inst, err := b.Step()
+		if err != nil {
+			t.Fatalf("Step: unexpected error: %v", err)
+		}
+		if *next != *instFromWord(before[addr]) || *next != *inst {
+			t.Errorf("line %d: NextStep() = %v, Step() executed %v", addr, next, inst)
+		}
+		if last, _ := b.LastStep(); last != addr {
+			t.Errorf("NextStep() = %d, but Step() executed line %d", addr, last)
+		}
+
+		switch inst.op {
+		case JMP, JRP:
+			if int32(b.ci) == addr {
+				t.Errorf("line %d: %v left ci at %d", addr, inst, b.ci)
+			}
+		case CMP:
+		default:
+			if int32(b.ci) != addr {
+				t.Errorf("line %d: %v moved ci to %d", addr, inst, b.ci)
+			}
+		}
+	}
+
+	b.SetCI(words - 1)
+	if addr, inst := b.NextStep(); addr != -1 || inst != nil {
+		t.Errorf("NextStep() at the end of the store = %d, %v, want -1, nil", addr, inst)
+	}
+}
+
+func TestMapMemory(t *testing.T) {
+	mem := loopMem()
+	b := NewBaby(mem)
+
+	cases := []struct {
+		fn   func(addr, word int32) int32
+		want memory
+	}{
+		{func(addr, word int32) int32 { return word }, mem},
+		{func(addr, word int32) int32 { return 0 }, memory{}},
+		{func(addr, word int32) int32 { return -word }, memory{1: -mem[1], 2: -mem[2], 5: -1}},
+		{func(addr, word int32) int32 { return addr }, func() (m memory) {
+			for i := range m {
+				m[i] = int32(i)
+			}
+			return m
+		}()},
+	}
+
+	for i, tc := range cases {
+		if got := b.MapMemory(tc.fn); got != tc.want {
+			t.Errorf("case %d: got(%v) != want(%v)", i, got, tc.want)
+		}
+		if b.mem != mem {
+			t.Errorf("case %d: MapMemory changed the store", i)
+		}
+	}
+}
+
+func TestFilterMemory(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+	b := NewBaby(mem)
+
+	var nonZero []int32
+	b.ForEachNonZero(func(addr, raw int32, inst *instruction) { nonZero = append(nonZero, addr) })
+	if got := b.FilterMemory(func(addr, word int32) bool { return word != 0 }); !reflect.DeepEqual(got, nonZero) {
+		t.Errorf("non-zero words: got(%v) != want(%v)", got, nonZero)
+	}
+
+	if err := b.CompileAndLoad("LDN a\nSUB a\nSUB b\nSTO b\nSUB a\nSTP\na: NUM 5\nb: NUM 6\n"); err != nil {
+		t.Fatalf("CompileAndLoad: unexpected error: %v", err)
+	}
+	subs := b.FilterMemory(func(addr, word int32) bool { return instFromWord(word).op == SUB })
+	if want := []int32{1, 2, 4}; !reflect.DeepEqual(subs, want) {
+		t.Errorf("SUB instructions: got(%v) != want(%v)", subs, want)
+	}
+
+	if got := b.FilterMemory(func(addr, word int32) bool { return false }); len(got) != 0 {
+		t.Errorf("nothing selected: got(%v) != want([])", got)
+	}
+}
+
+func TestWordCount(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+	b := NewBaby(mem)
+
+	// test.baby has 3 LDN instructions, and no data that decodes to LDN.
+	if got := b.WordCount(LDN); got != 3 {
+		t.Errorf("WordCount(LDN) = %d, want 3", got)
+	}
+
+	// Every word, zeros and data included, decodes to some function.
+	total := 0
+	for op := int32(JMP); op <= STP; op++ {
+		total += b.WordCount(op)
+	}
+	if total != words {
+		t.Errorf("WordCount over every function = %d, want %d", total, words)
+	}
+
+	if got := NewBaby(memory{}).WordCount(STP); got != 0 {
+		t.Errorf("WordCount(STP) of an empty store = %d, want 0", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	cases := []struct {
+		inst instruction
+		want string
+	}{
+		{instruction{op: JMP, data: 3}, "jump: set ci to the word in store line 3, so execution continues from the line after it"},
+		{instruction{op: JRP, data: 4}, "relative jump: add the word in store line 4 to ci"},
+		{instruction{op: LDN, data: 20}, "load the negative of store line 20 into the accumulator"},
+		{instruction{op: STO, data: 31}, "store the accumulator in store line 31"},
+		{instruction{op: SUB, data: 21}, "subtract store line 21 from the accumulator"},
+		{instruction{op: SUB2, data: 21}, "subtract store line 21 from the accumulator"},
+		{instruction{op: CMP}, "skip the next instruction if the accumulator is negative"},
+		{instruction{op: STP}, "stop the machine"},
+	}
+
+	for i, tc := range cases {
+		if got := Describe(&tc.inst); got != tc.want {
+			t.Errorf("case %d: got(%q) != want(%q)", i, got, tc.want)
+		}
+	}
+}
+
+func TestCycleCountSince(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.StepN(3)
+
+	mark := b.CycleCount()
+	if got := b.CycleCountSince(mark); got != 0 {
+		t.Errorf("CycleCountSince(mark) straight away = %d, want 0", got)
+	}
+	b.StepN(10)
+	if got := b.CycleCountSince(mark); got != 10 {
+		t.Errorf("CycleCountSince(mark) after 10 steps = %d, want 10", got)
+	}
+	b.Reset()
+	if got := b.CycleCountSince(mark); got != -3 {
+		t.Errorf("CycleCountSince(mark) after Reset = %d, want -3", got)
+	}
+}
+
+func TestExplainStep(t *testing.T) {
+	cases := []struct {
+		inst *instruction
+		acc  register
+		want string
+	}{
+		{&instruction{op: JMP, data: 10}, 0, "0001 JMP 10: CI = store line 10 (7), continuing from line 8"},
+		{&instruction{op: JRP, data: 10}, 0, "0001 JRP 10: CI = CI (1) + store line 10 (7), continuing from line 9"},
+		{&instruction{op: LDN, data: 10}, 0, "0001 LDN 10: ACC = -store line 10 (7) = -7"},
+		{&instruction{op: STO, data: 10}, -2, "0001 STO 10: store line 10 (7) = ACC (-2)"},
+		{&instruction{op: SUB, data: 10}, 5, "0001 SUB 10: ACC = ACC (5) - store line 10 (7) = -2"},
+		{&instruction{op: CMP}, -1, "0001 CMP: ACC (-1) is negative, so CI = 2, skipping line 2"},
+		{&instruction{op: CMP}, 0, "0001 CMP: ACC (0) isn't negative, so line 2 runs next"},
+		{&instruction{op: STP}, 0, "0001 STP: stop the machine"},
+	}
+
+	for i, tc := range cases {
+		var mem memory
+		mem[1] = tc.inst.toInt32()
+		mem[10] = 7
+		b := NewBaby(mem)
+		b.acc = tc.acc
+
+		if got := b.ExplainStep(); got != tc.want {
+			t.Errorf("case %d: got(%q) != want(%q)", i, got, tc.want)
+		}
+		if got := b.StepVerbose(); got != tc.want || b.cycles != 1 {
+			t.Errorf("case %d: StepVerbose() = %q after %d steps, want %q after 1", i, got, b.cycles, tc.want)
+		}
+	}
+
+	b := NewBaby(memory{})
+	b.ci = words - 1
+	if got := b.ExplainStep(); got != "" {
+		t.Errorf("ExplainStep() at the end of the store = %q", got)
+	}
+	if got := b.StepVerbose(); got != badCI.Error() {
+		t.Errorf("StepVerbose() at the end of the store = %q, want %q", got, badCI.Error())
+	}
+}
+
+func TestStepVerboseJump(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.Step()
+
+	got := b.StepVerbose()
+	if !strings.Contains(got, "CI") || !strings.Contains(got, "store line 6") {
+		t.Errorf("StepVerbose() = %q, want it to mention CI and store line 6", got)
+	}
+	if b.ci != register(b.mem[6]) {
+		t.Errorf("after StepVerbose ci(%d) != %d", b.ci, b.mem[6])
+	}
+	// Plain steps don't keep explanations.
+	b.lastExplain = ""
+	b.Step()
+	if b.lastExplain != "" {
+		t.Errorf("Step kept explanation %q", b.lastExplain)
+	}
+}
+
+// gcdProgram finds the greatest common divisor of lines 28 and 29 by
+// repeated subtraction, stopping with its negative in the accumulator.
+const gcdProgram = `0000 NUM 0
+0001 LDN 28 ; acc = a
+0002 STO 31
+0003 LDN 31
+0004 SUB 29 ; acc = a - b
+0005 CMP
+0006 JMP 25 ; a >= b
+0007 LDN 29 ; b -= a
+0008 STO 31
+0009 LDN 31
+0010 SUB 28
+0011 STO 29
+0012 JMP 26
+0014 STO 28 ; a -= b
+0015 LDN 28
+0016 CMP
+0017 JMP 27 ; a was b
+0018 JMP 26
+0019 LDN 29
+0020 STP
+0025 NUM 13
+0026 NUM 0
+0027 NUM 18
+0028 NUM 48
+0029 NUM 18
+`
+
+func TestRunN(t *testing.T) {
+	cases := []struct {
+		mem         memory
+		n           int
+		maxSteps    int64
+		wantErr     error
+		wantCycles  int64
+		wantRunning bool
+	}{
+		{breakMem(), 0, 0, nil, 4, false},
+		{breakMem(), 4, 0, nil, 4, false},
+		{breakMem(), 3, 0, tooManySteps, 3, true},
+		{loopMem(), 25, 0, tooManySteps, 25, true},
+		{loopMem(), 0, 12, tooManySteps, 12, false},
+		{loopMem(), 20, 12, tooManySteps, 12, false},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(tc.mem)
+		b.SetMaxSteps(tc.maxSteps)
+		err := b.RunN(tc.n)
+		if !errors.Is(err, tc.wantErr) || b.cycles != tc.wantCycles || b.running != tc.wantRunning {
+			t.Errorf("case %d: got(%v, %d, %t) != want(%v, %d, %t)", i, err, b.cycles, b.running, tc.wantErr, tc.wantCycles, tc.wantRunning)
+		}
+	}
+}
+
+func TestLoadAndRun(t *testing.T) {
+	gcd := writeProgram(t, gcdProgram)
+
+	b := NewBaby(memory{})
+	got, err := b.LoadAndRun(gcd, 0)
+	if err != nil {
+		t.Fatalf("LoadAndRun: unexpected error: %v", err)
+	}
+	if got.ACC != -6 || got.Running || got.Cycle != b.cycles || b.mem[29] != 6 {
+		t.Errorf("LoadAndRun() = %+v, mem[29] = %d; want acc -6 and gcd 6", got, b.mem[29])
+	}
+	steps := got.Cycle
+
+	cases := []struct {
+		path     string
+		maxSteps int
+		wantErr  error
+	}{
+		{gcd, int(steps), nil},
+		{gcd, int(steps) - 1, tooManySteps},
+		{writeProgram(t, "0001 JMP 2\n0002 NUM 40\n"), 0, badCI},
+	}
+
+	for i, tc := range cases {
+		_, err := NewBaby(memory{}).LoadAndRun(tc.path, tc.maxSteps)
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("case %d: got(%v) != want(%v)", i, err, tc.wantErr)
+		}
+	}
+	if _, err := NewBaby(memory{}).LoadAndRun(filepath.Join(t.TempDir(), "missing"), 0); err == nil {
+		t.Errorf("LoadAndRun of a missing file succeeded")
+	}
+}
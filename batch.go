@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Exit codes for headless and compare runs.
+const (
+	exitOK       = 0 // The program reached STP (and matched, when comparing)
+	exitError    = 1 // Any other failure, such as a runtime error
+	exitLoad     = 2 // The program or expected store couldn't be loaded
+	exitMaxSteps = 3 // The step limit was reached before STP
+	exitMismatch = 4 // The final store differed from the expected store
+)
+
+var (
+	loadFailed    = errors.New("invalid program - couldn't load")
+	storeMismatch = errors.New("invalid result - final store differs from expected")
+	suiteFailed   = errors.New("invalid result - suite programs failed")
+	emptySuite    = errors.New("invalid suite - no programs in directory")
+)
+
+// suiteExts are the extensions of the programs runSuite runs.
+var suiteExts = []string{".asm", ".bin", ".baby"}
+
+// batchOptions controls a non-interactive run.
+type batchOptions struct {
+	asm         assembler
+	programfile string
+	program     string // inline program run instead of programfile
+	compare     string // program whose store the final store must match
+	maxSteps    int64
+	detectLoop  bool
+	timing      timingModel
+	plot        string // file to write the accumulator CSV to
+}
+
+// exitCode maps the result of runBatch to a process exit code.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, loadFailed):
+		return exitLoad
+	case errors.Is(err, tooManySteps):
+		return exitMaxSteps
+	case errors.Is(err, storeMismatch), errors.Is(err, suiteFailed):
+		return exitMismatch
+	default:
+		return exitError
+	}
+}
+
+// memDiff is a store line that differs between two stores.
+type memDiff struct {
+	addr      int32
+	got, want int32
+}
+
+// diffMemory returns the lines where got and want differ, in address
+// order.
+func diffMemory(got, want memory) []memDiff {
+	var diffs []memDiff
+
+	for addr := range got {
+		if got[addr] != want[addr] {
+			diffs = append(diffs, memDiff{int32(addr), got[addr], want[addr]})
+		}
+	}
+
+	return diffs
+}
+
+// runBatch runs a program to completion without display, writing the
+// final registers, and any differences from the expected store, to w.
+func runBatch(opts batchOptions, w io.Writer) error {
+	p, err := opts.asm.assembleSource(opts.program, opts.programfile)
+	if err != nil {
+		return fmt.Errorf("%w: %v", loadFailed, err)
+	}
+
+	var want memory
+	if opts.compare != "" {
+		e, err := opts.asm.assembleFile(opts.compare)
+		if err != nil {
+			return fmt.Errorf("%w: %v", loadFailed, err)
+		}
+		want = e.mem
+	}
+
+	b := newBabyFromProgram(p)
+	b.SetHistoryDepth(0)
+	b.SetMaxSteps(opts.maxSteps)
+	b.SetLoopDetection(opts.detectLoop)
+	b.SetTiming(opts.timing)
+	b.RecordAccumulator(opts.plot != "")
+	runErr := b.RunN(0)
+	if opts.plot != "" {
+		if err := writePlotFile(b, opts.plot); err != nil {
+			return err
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	fmt.Fprintf(w, "ci: %d, acc: %d, cycles: %d\n", b.ci, b.acc, b.cycles)
+	fmt.Fprintf(w, "simulated time: %v\n", b.SimulatedDuration())
+
+	if opts.compare != "" {
+		diffs := diffMemory(b.mem, want)
+		for _, d := range diffs {
+			fmt.Fprintf(w, "%04d: got %d, want %d\n", d.addr, d.got, d.want)
+		}
+		if len(diffs) > 0 {
+			return storeMismatch
+		}
+	}
+
+	return nil
+}
+
+// diffPrograms writes the store lines where the inline program src, or the
+// one in path a if src is empty, and the program in path b differ before
+// either runs to w, with both words and their disassembly. storeMismatch is
+// returned if there are any.
+func diffPrograms(asm assembler, src, a, b string, w io.Writer) error {
+	pa, err := asm.assembleSource(src, a)
+	if err != nil {
+		return fmt.Errorf("%w: %v", loadFailed, err)
+	}
+	pb, err := asm.assembleFile(b)
+	if err != nil {
+		return fmt.Errorf("%w: %v", loadFailed, err)
+	}
+
+	diffs := diffMemory(pa.mem, pb.mem)
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%04d: %d (%s) | %d (%s)\n", d.addr, d.got, disassemble(d.got), d.want, disassemble(d.want))
+	}
+	if len(diffs) > 0 {
+		return storeMismatch
+	}
+
+	return nil
+}
+
+// runSuite runs each program in dir as runBatch does, comparing its final
+// store with the program of the same name with a .expected extension. It
+// writes a line for each program, with the output of any that fail, and a
+// count of passes and failures to w. suiteFailed is returned if any
+// program fails.
+func runSuite(opts batchOptions, dir string, w io.Writer) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("%w: %v", loadFailed, err)
+	}
+
+	var passed, failed int
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || !contains(suiteExts, ext) {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		opts.programfile = path
+		opts.program = ""
+		opts.compare = strings.TrimSuffix(path, ext) + ".expected"
+		opts.plot = ""
+
+		var out strings.Builder
+		if err := runBatch(opts, &out); err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %v\n", e.Name(), err)
+			for _, line := range strings.SplitAfter(out.String(), "\n") {
+				if line != "" {
+					fmt.Fprintf(w, "    %s", line)
+				}
+			}
+			continue
+		}
+		passed++
+		fmt.Fprintf(w, "ok   %s\n", e.Name())
+	}
+
+	if passed+failed == 0 {
+		return emptySuite
+	}
+	fmt.Fprintf(w, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d", suiteFailed, failed, passed+failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProgram(t *testing.T, src string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "program.baby")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatalf("writing program: %v", err)
+	}
+
+	return path
+}
+
+func TestRunBatchExitCodes(t *testing.T) {
+	stop := writeProgram(t, "0001 LDN 5\n0002 STO 6\n0003 STP\n0005 NUM 3\n")
+	stopped := writeProgram(t, "0001 LDN 5\n0002 STO 6\n0003 STP\n0005 NUM 3\n0006 NUM -3\n")
+	loop := writeProgram(t, "0001 SUB 5\n0002 JMP 6\n0005 NUM 1\n")
+	bad := writeProgram(t, "0001 LDN\n")
+
+	cases := []struct {
+		opts    batchOptions
+		wantErr error
+		want    int
+	}{
+		{batchOptions{programfile: stop}, nil, exitOK},
+		{batchOptions{programfile: stop, compare: stopped}, nil, exitOK},
+		{batchOptions{programfile: stop, compare: stop}, storeMismatch, exitMismatch},
+		{batchOptions{programfile: loop, maxSteps: 100}, tooManySteps, exitMaxSteps},
+		{batchOptions{programfile: bad}, loadFailed, exitLoad},
+		{batchOptions{programfile: stop, compare: bad}, loadFailed, exitLoad},
+		{batchOptions{programfile: filepath.Join(t.TempDir(), "missing")}, loadFailed, exitLoad},
+		{batchOptions{program: "0001 LDN 5;0002 STO 6;0003 STP;0005 NUM 3", compare: stopped}, nil, exitOK},
+		{batchOptions{program: "0001 LDN", programfile: stop}, loadFailed, exitLoad},
+	}
+
+	for i, tc := range cases {
+		err := runBatch(tc.opts, io.Discard)
+		if got := exitCode(err); got != tc.want {
+			t.Errorf("case %d: exitCode(%v) = %d, want %d", i, err, got, tc.want)
+		}
+		if exitCode(tc.wantErr) != tc.want {
+			t.Errorf("case %d: exitCode(%v) = %d, want %d", i, tc.wantErr, exitCode(tc.wantErr), tc.want)
+		}
+	}
+
+	if got := exitCode(badCI); got != exitError {
+		t.Errorf("exitCode(%v) = %d, want %d", badCI, got, exitError)
+	}
+}
+
+func TestRunBatchSourceLine(t *testing.T) {
+	jump := writeProgram(t, "\n\n0001 LDN 5\n0002 JMP 6\n0005 NUM 0\n0006 NUM 40\n")
+
+	err := runBatch(batchOptions{programfile: jump}, io.Discard)
+	if !errors.Is(err, badCI) {
+		t.Fatalf("runBatch() = %v, want %v", err, badCI)
+	}
+	if want := "(source line 4)"; !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("runBatch() = %q, want it to cite %s", err, want)
+	}
+}
+
+func TestDiffPrograms(t *testing.T) {
+	var out strings.Builder
+	if err := diffPrograms(assembler{}, "", "primes.baby", "primes.baby", &out); err != nil || out.Len() != 0 {
+		t.Errorf("diffPrograms(primes, primes) = %v, output %q, want nil and nothing", err, out.String())
+	}
+
+	a, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+	b, err := loadProgram("sum_sequence.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+	out.Reset()
+	if err := diffPrograms(assembler{}, "", "test.baby", "sum_sequence.baby", &out); err != storeMismatch {
+		t.Errorf("diffPrograms(test, sum_sequence) = %v, want %v", err, storeMismatch)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	diffs := diffMemory(a, b)
+	if len(lines) != len(diffs) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(diffs), out.String())
+	}
+	d := diffs[0]
+	if want := fmt.Sprintf("%04d: %d (%s) | %d (%s)", d.addr, d.got, disassemble(d.got), d.want, disassemble(d.want)); lines[0] != want {
+		t.Errorf("first line = %q, want %q", lines[0], want)
+	}
+
+	if err := diffPrograms(assembler{}, "", "test.baby", filepath.Join(t.TempDir(), "missing"), &out); !errors.Is(err, loadFailed) {
+		t.Errorf("diffPrograms with a missing program = %v, want %v", err, loadFailed)
+	}
+
+	// An inline program is compared in place of the first file.
+	out.Reset()
+	if err := diffPrograms(assembler{}, "0001 LDN 5;0005 NUM 3", "primes.baby", "primes.baby", &out); err != storeMismatch || !strings.Contains(out.String(), "\n0001: 16389 (LDN 5) | ") {
+		t.Errorf("diffPrograms(-program, primes) = %v, output %q, want %v with the inline LDN 5", err, out.String(), storeMismatch)
+	}
+	out.Reset()
+	if err := diffPrograms(assembler{}, "0001 LDN 5;0002 STP", "primes.baby", writeProgram(t, "0001 LDN 5\n0002 STP\n"), &out); err != nil || out.Len() != 0 {
+		t.Errorf("diffPrograms(-program, same program) = %v, output %q, want nil and nothing", err, out.String())
+	}
+}
+
+func TestDiffMemory(t *testing.T) {
+	a, b := loopMem(), loopMem()
+	b[3], b[31] = 4, -1
+
+	want := []memDiff{{3, 0, 4}, {31, 0, -1}}
+	got := diffMemory(a, b)
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("diffMemory = %v, want %v", got, want)
+	}
+	if got := diffMemory(a, a); len(got) != 0 {
+		t.Errorf("diffMemory of identical stores = %v, want none", got)
+	}
+}
+
+func TestRunSuite(t *testing.T) {
+	var out strings.Builder
+	err := runSuite(batchOptions{}, filepath.Join("testdata", "suite"), &out)
+	if !errors.Is(err, suiteFailed) || exitCode(err) != exitMismatch {
+		t.Errorf("runSuite() = %v, want %v", err, suiteFailed)
+	}
+	for _, want := range []string{
+		"ok   negate.asm\n",
+		"ok   negate_bin.bin\n",
+		"FAIL subtract.baby: " + storeMismatch.Error() + "\n",
+		"    0007: got 8, want 9\n",
+		"2 passed, 1 failed\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("runSuite() output is missing %q:\n%s", want, out.String())
+		}
+	}
+
+	// A program without an expected store fails to load.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "stop.asm"), []byte("0001 STP\n"), 0644); err != nil {
+		t.Fatalf("writing program: %v", err)
+	}
+	out.Reset()
+	if err := runSuite(batchOptions{}, dir, &out); !errors.Is(err, suiteFailed) || !strings.Contains(out.String(), loadFailed.Error()) {
+		t.Errorf("runSuite() = %v, want %v with a load failure:\n%s", err, suiteFailed, out.String())
+	}
+
+	cases := []struct {
+		dir  string
+		want error
+	}{
+		{t.TempDir(), emptySuite},
+		{filepath.Join(t.TempDir(), "missing"), loadFailed},
+	}
+
+	for i, tc := range cases {
+		if err := runSuite(batchOptions{}, tc.dir, io.Discard); !errors.Is(err, tc.want) {
+			t.Errorf("case %d: got(%v) != want(%v)", i, err, tc.want)
+		}
+	}
+}
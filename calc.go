@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	calcResultLine = words - 1 // Line a compiled expression leaves its result on
+	calcMaxTerms   = 13        // Most terms whose code and data fit in the store
+)
+
+var (
+	badExpr   = errors.New("invalid expression - want numbers separated by + or -")
+	longExpr  = errors.New("invalid expression - too many terms to fit in the store")
+	calcStuck = errors.New("invalid expression - compiled program didn't stop")
+)
+
+// compileExpr compiles an expression of integers added and subtracted, such
+// as "12 + 30 - 7", into a Baby program that leaves its value on
+// calcResultLine. The machine can only load negated values and subtract, so
+// the program accumulates the negated result: LDN loads the first term,
+// each added term is subtracted and each subtracted term is stored negated
+// (at assembly time) and subtracted. Finally the total is stored, loaded
+// back negated to correct its sign and stored again.
+func compileExpr(expr string) (string, error) {
+	terms, err := parseExpr(expr)
+	if err != nil {
+		return "", err
+	}
+	if len(terms) > calcMaxTerms {
+		return "", longExpr
+	}
+
+	var (
+		sb   strings.Builder
+		line int32
+	)
+	emit := func(format string, args ...interface{}) {
+		line++
+		fmt.Fprintf(&sb, "%04d "+format+"\n", append([]interface{}{line}, args...)...)
+	}
+
+	data := int32(len(terms) + 5) // First line after the code
+	emit("LDN %d", data)
+	for i := 1; i < len(terms); i++ {
+		emit("SUB %d", data+int32(i))
+	}
+	emit("STO %d", calcResultLine)
+	emit("LDN %d", calcResultLine)
+	emit("STO %d", calcResultLine)
+	emit("STP")
+	for _, t := range terms {
+		emit("NUM %d", t)
+	}
+
+	return sb.String(), nil
+}
+
+// parseExpr splits expr into its terms, negating those that are subtracted
+// (other than the first).
+func parseExpr(expr string) ([]int32, error) {
+	var (
+		terms []int32
+		sign  = int32(1)
+	)
+
+	s := strings.TrimSpace(expr)
+	for {
+		end := 0
+		if end < len(s) && s[end] == '-' {
+			end++
+		}
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+		}
+		v, err := strconv.ParseInt(s[:end], 10, 32)
+		if err != nil {
+			return nil, badExpr
+		}
+		if len(terms) == 0 {
+			terms = append(terms, int32(v))
+		} else {
+			terms = append(terms, sign*int32(v))
+		}
+
+		s = strings.TrimSpace(s[end:])
+		if s == "" {
+			return terms, nil
+		}
+		switch s[0] {
+		case '+':
+			sign = 1
+		case '-':
+			sign = -1
+		default:
+			return nil, badExpr
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+// calculate evaluates expr by compiling it with compileExpr and running the
+// result on a fresh machine. Arithmetic wraps at 32 bits, just as the Baby's
+// does.
+func calculate(expr string) (int32, error) {
+	src, err := compileExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+	p, err := assemble(strings.NewReader(src))
+	if err != nil {
+		return 0, err
+	}
+
+	b := newBabyFromProgram(p)
+	b.SetMaxSteps(calcMaxTerms + 4)
+	if err := b.RunN(0); err != nil {
+		return 0, calcStuck
+	}
+
+	return b.mem[calcResultLine], nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCalculate(t *testing.T) {
+	cases := []struct {
+		expr    string
+		want    int32
+		wantErr error
+	}{
+		{"42", 42, nil},
+		{"12 + 30 - 7", 35, nil},
+		{"-3+5", 2, nil},
+		{"10 - -4", 14, nil},
+		{"1-2-3-4", -8, nil},
+		{"2147483647 + 1", math.MinInt32, nil},
+		{"1+1+1+1+1+1+1+1+1+1+1+1+1", 13, nil},
+		{"1+1+1+1+1+1+1+1+1+1+1+1+1+1", 0, longExpr},
+		{"", 0, badExpr},
+		{"1 +", 0, badExpr},
+		{"2 * 3", 0, badExpr},
+		{"abc", 0, badExpr},
+	}
+
+	for i, tc := range cases {
+		got, err := calculate(tc.expr)
+		if err != tc.wantErr {
+			t.Errorf("case %d: got err(%v) != want err(%v)", i, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("case %d: got(%d) != want(%d) for %q", i, got, tc.want, tc.expr)
+		}
+	}
+}
+
+func TestCompileExpr(t *testing.T) {
+	src, err := compileExpr("5 - 2")
+	if err != nil {
+		t.Fatalf("compileExpr() = %v", err)
+	}
+	want := "0001 LDN 7\n0002 SUB 8\n0003 STO 31\n0004 LDN 31\n0005 STO 31\n0006 STP\n0007 NUM 5\n0008 NUM -2\n"
+	if src != want {
+		t.Errorf("got:\n%s\nwant:\n%s", src, want)
+	}
+	if _, err := assemble(strings.NewReader(src)); err != nil {
+		t.Errorf("assemble() = %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// castWidth is the terminal width given in recordings; store lines with
+// long annotations may be wider.
+const castWidth = 80
+
+// castHeader is the first line of an asciicast version 2 recording.
+type castHeader struct {
+	Version int `json:"version"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+}
+
+// castRecorder writes the frames Run draws as an asciicast version 2
+// recording, which asciinema can replay. Frames are timestamped a fixed
+// interval apart, however long the run actually took, so recordings are
+// the same from run to run.
+type castRecorder struct {
+	w        io.Writer
+	interval time.Duration
+	frames   int
+}
+
+// RecordCast records each frame Run draws to w, as well as showing it, in
+// an asciicast recording with frames interval apart. The header is written
+// at once. A nil w stops recording.
+func (b *baby) RecordCast(w io.Writer, interval time.Duration) error {
+	b.cast = nil
+	if w == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(castHeader{Version: 2, Width: castWidth, Height: len(b.screenLines(b.rows))})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	b.cast = &castRecorder{w: w, interval: interval}
+	return nil
+}
+
+// CastFrames returns the number of frames recorded since RecordCast.
+func (b *baby) CastFrames() int {
+	if b.cast == nil {
+		return 0
+	}
+
+	return b.cast.frames
+}
+
+// frame draws the machine on the terminal and, when recording, adds the
+// same picture to the recording.
+func (b *baby) frame() {
+	b.Display()
+	if b.cast == nil {
+		return
+	}
+
+	var sb strings.Builder
+	b.DisplayTo(&sb)
+	b.cast.write(sb.String())
+}
+
+// write appends an output event holding s, stamped with the time of the
+// next frame. Write errors are ignored, as they are for the display.
+func (c *castRecorder) write(s string) {
+	at := time.Duration(c.frames) * c.interval
+	line, _ := json.Marshal([]any{at.Seconds(), "o", s})
+	c.w.Write(append(line, '\n'))
+	c.frames++
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordCast(t *testing.T) {
+	cases := []struct {
+		interval   int
+		wantFrames int
+	}{
+		{1, 12},
+		{5, 4},
+		{0, 1},
+	}
+
+	for i, tc := range cases {
+		sleeper := &fakeSleeper{}
+		b := NewWithConfig(BabyConfig{Memory: loopMem(), MaxSteps: 10, Sleeper: sleeper})
+		b.SetDisplayInterval(tc.interval)
+		var out, cast strings.Builder
+		b.ConnectTerminal(strings.NewReader(""), &out)
+		if err := b.RecordCast(&cast, 100*time.Millisecond); err != nil {
+			t.Fatalf("case %d: RecordCast: unexpected error: %v", i, err)
+		}
+
+		b.Run()
+		if got := b.CastFrames(); got != tc.wantFrames {
+			t.Errorf("case %d: got(%d) != want(%d) frames", i, got, tc.wantFrames)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(cast.String(), "\n"), "\n")
+		var h castHeader
+		if err := json.Unmarshal([]byte(lines[0]), &h); err != nil || h.Version != 2 || h.Height != len(b.screenLines(0)) {
+			t.Errorf("case %d: header %q (%v)", i, lines[0], err)
+		}
+		if len(lines)-1 != tc.wantFrames {
+			t.Fatalf("case %d: %d events, want %d", i, len(lines)-1, tc.wantFrames)
+		}
+		// Frames are evenly spaced whatever the sleeper did, and show
+		// what the terminal did.
+		for n, line := range lines[1:] {
+			var ev []any
+			if err := json.Unmarshal([]byte(line), &ev); err != nil || len(ev) != 3 {
+				t.Fatalf("case %d: event %d = %q (%v)", i, n, line, err)
+			}
+			if at, want := ev[0].(float64), (time.Duration(n) * 100 * time.Millisecond).Seconds(); at != want {
+				t.Errorf("case %d: event %d at %v, want %v", i, n, at, want)
+			}
+			if s := ev[2].(string); ev[1] != "o" || !strings.Contains(out.String(), s) {
+				t.Errorf("case %d: event %d isn't a frame shown on the terminal", i, n)
+			}
+		}
+	}
+
+	b := NewBaby(loopMem())
+	b.RecordCast(nil, time.Second)
+	if got := b.CastFrames(); got != 0 {
+		t.Errorf("CastFrames() without recording = %d", got)
+	}
+}
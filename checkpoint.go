@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var noCheckpoint = errors.New("invalid checkpoint - none at or before that cycle")
+
+// checkpoint is a copy of the machine taken after a step.
+type checkpoint struct {
+	cycle    int64
+	ci, acc  register
+	running  bool
+	beats    int64
+	mem      memory
+	counts   [3][words]int64 // addrCounts, readCounts and writeCounts
+	last     int32
+	lastInst *instruction
+}
+
+// CheckpointEvery makes the machine save a copy of itself after every n
+// steps, numbered from the last reset, for RestoreCheckpoint to go back
+// to. The current state is saved as the first checkpoint. An n of 0 or
+// less stops checkpointing and discards the checkpoints taken.
+func (b *baby) CheckpointEvery(n int) {
+	b.checkpointN = n
+	b.checkpoints = nil
+	if n > 0 {
+		b.saveCheckpoint()
+	}
+}
+
+// Checkpoints returns the cycles of the saved checkpoints, oldest first.
+func (b *baby) Checkpoints() []int64 {
+	cycles := make([]int64, len(b.checkpoints))
+	for i, c := range b.checkpoints {
+		cycles[i] = c.cycle
+	}
+
+	return cycles
+}
+
+// RestoreCheckpoint returns the machine to the latest checkpoint taken at
+// or before cycle, discarding any later ones and the history of the steps
+// since. The store, registers and execution counts are restored.
+func (b *baby) RestoreCheckpoint(cycle int) error {
+	i := len(b.checkpoints) - 1
+	for i >= 0 && b.checkpoints[i].cycle > int64(cycle) {
+		i--
+	}
+	if i < 0 {
+		return fmt.Errorf("%w %d", noCheckpoint, cycle)
+	}
+
+	c := b.checkpoints[i]
+	b.checkpoints = b.checkpoints[:i+1]
+	b.cycles, b.ci, b.acc, b.running, b.beats, b.mem = c.cycle, c.ci, c.acc, c.running, c.beats, c.mem
+	b.addrCounts, b.readCounts, b.writeCounts = c.counts[0], c.counts[1], c.counts[2]
+	b.last, b.lastInst = c.last, c.lastInst
+	if b.running {
+		b.clearHalt()
+	}
+	for len(b.history) > 0 && b.history[len(b.history)-1].Cycle > b.cycles {
+		b.history = b.history[:len(b.history)-1]
+	}
+	for len(b.accLog) > 0 && b.accLog[len(b.accLog)-1].cycle > b.cycles {
+		b.accLog = b.accLog[:len(b.accLog)-1]
+	}
+	if b.loops != nil {
+		b.loops.reset()
+	}
+
+	return nil
+}
+
+// saveCheckpoint appends a checkpoint of the current state.
+func (b *baby) saveCheckpoint() {
+	b.checkpoints = append(b.checkpoints, checkpoint{
+		cycle:    b.cycles,
+		ci:       b.ci,
+		acc:      b.acc,
+		running:  b.running,
+		beats:    b.beats,
+		mem:      b.mem,
+		counts:   [3][words]int64{b.addrCounts, b.readCounts, b.writeCounts},
+		last:     b.last,
+		lastInst: b.lastInst,
+	})
+}
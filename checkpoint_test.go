@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// counterMem counts up in line 20 forever, six steps to each count.
+func counterMem() memory {
+	var mem memory
+	mem[1] = (&instruction{op: LDN, data: 20}).toInt32()
+	mem[2] = (&instruction{op: SUB, data: 21}).toInt32()
+	mem[3] = (&instruction{op: STO, data: 22}).toInt32()
+	mem[4] = (&instruction{op: LDN, data: 22}).toInt32()
+	mem[5] = (&instruction{op: STO, data: 20}).toInt32()
+	mem[6] = (&instruction{op: JMP, data: 23}).toInt32()
+	mem[21] = 1
+	return mem
+}
+
+func TestCheckpointEvery(t *testing.T) {
+	want := NewBaby(counterMem())
+	want.StepN(50)
+
+	b := NewBaby(counterMem())
+	b.CheckpointEvery(10)
+	if n, err := b.StepN(100); n != 100 || err != nil {
+		t.Fatalf("StepN(100) = %d, %v, want 100, nil", n, err)
+	}
+	if got, want := b.Checkpoints(), []int64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Checkpoints() = %v, want %v", got, want)
+	}
+
+	if err := b.RestoreCheckpoint(55); err != nil {
+		t.Fatalf("RestoreCheckpoint(55): unexpected error: %v", err)
+	}
+	if b.cycles != 50 || b.ci != want.ci || b.acc != want.acc || b.mem != want.mem {
+		t.Errorf("restored cycles %d, ci %d, acc %d; want cycles 50, ci %d, acc %d", b.cycles, b.ci, b.acc, want.ci, want.acc)
+	}
+	if b.addrCounts != want.addrCounts {
+		t.Errorf("restored execution counts %v, want %v", b.addrCounts, want.addrCounts)
+	}
+	if got, want := b.Checkpoints(), []int64{0, 10, 20, 30, 40, 50}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after restoring, Checkpoints() = %v, want %v", got, want)
+	}
+
+	// Running on takes the same checkpoints again.
+	b.StepN(10)
+	want.StepN(10)
+	if b.ci != want.ci || b.acc != want.acc {
+		t.Errorf("after restoring and 10 steps, ci %d, acc %d; want ci %d, acc %d", b.ci, b.acc, want.ci, want.acc)
+	}
+	if got := b.Checkpoints(); got[len(got)-1] != 60 {
+		t.Errorf("after 10 more steps, Checkpoints() = %v", got)
+	}
+
+	if err := b.RestoreCheckpoint(-1); !errors.Is(err, noCheckpoint) {
+		t.Errorf("RestoreCheckpoint(-1) = %v, want %v", err, noCheckpoint)
+	}
+
+	b.Reset()
+	if got, want := b.Checkpoints(), []int64{0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after Reset, Checkpoints() = %v, want %v", got, want)
+	}
+	b.CheckpointEvery(0)
+	b.StepN(20)
+	if err := b.RestoreCheckpoint(10); !errors.Is(err, noCheckpoint) {
+		t.Errorf("RestoreCheckpoint(10) without checkpoints = %v, want %v", err, noCheckpoint)
+	}
+}
+
+func TestCheckpointStepBack(t *testing.T) {
+	want := NewBaby(counterMem())
+	want.StepN(15)
+
+	b := NewBaby(counterMem())
+	b.CheckpointEvery(10)
+	b.StepN(10)
+	if err := b.StepBack(); err != nil {
+		t.Fatalf("StepBack(): unexpected error: %v", err)
+	}
+	if got, want := b.Checkpoints(), []int64{0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after stepping back past cycle 10, Checkpoints() = %v, want %v", got, want)
+	}
+
+	b.StepN(6)
+	if got, want := b.Checkpoints(), []int64{0, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after stepping forward again, Checkpoints() = %v, want %v", got, want)
+	}
+	if err := b.RestoreCheckpoint(10); err != nil {
+		t.Fatalf("RestoreCheckpoint(10): unexpected error: %v", err)
+	}
+	b.StepN(5)
+	if b.ci != want.ci || b.acc != want.acc || b.mem != want.mem {
+		t.Errorf("restored and stepped to cycle %d, ci %d, acc %d; want ci %d, acc %d", b.cycles, b.ci, b.acc, want.ci, want.acc)
+	}
+}
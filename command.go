@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// command is a subcommand, chosen by the first argument, that takes its
+// own flags and returns the process exit code. Without a subcommand the
+// flags in baby.go pick the mode, as they always have.
+type command struct {
+	args  string // the positional arguments, for the usage message
+	about string
+	run   func(fs *flag.FlagSet, args []string, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"run":      {"program", "run a program to completion without display, printing the final registers", cmdRun},
+	"compare":  {"program expected", "run a program and check its final store matches the store of expected", cmdCompare},
+	"assemble": {"program", "assemble a program and print the store in binary", cmdAssemble},
+	"disasm":   {"program", "print the assembly for the store a program sets up", cmdDisasm},
+	"lint":     {"program", "assemble and lint a program without running it", cmdLint},
+	"selftest": {"", "run the Baby's first program, the highest factor routine, and check its answer", cmdSelfTest},
+}
+
+// dispatchCommand runs the subcommand named by args[0], if there is one,
+// with the rest of args. It reports whether there was, and the exit code.
+func dispatchCommand(args []string, stdout, stderr io.Writer) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return 0, false
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s %s [flags] %s\n\n%s.\n\n", os.Args[0], args[0], cmd.args, cmd.about)
+		fs.PrintDefaults()
+	}
+
+	return cmd.run(fs, args[1:], stdout, stderr), true
+}
+
+// usage describes the subcommands and then the flags used without one.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: %s [flags]\n       %s command [flags] args\n\ncommands:\n", os.Args[0], os.Args[0])
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-9s %s\n", name, commands[name].about)
+	}
+
+	fmt.Fprintf(w, "\nflags without a command:\n")
+	flag.PrintDefaults()
+}
+
+// parseArgs parses args into fs, which must leave exactly n positional
+// arguments. On failure it returns false and the exit code to use.
+func parseArgs(fs *flag.FlagSet, args []string, n int) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitError, false
+	}
+	if fs.NArg() != n {
+		fmt.Fprintf(fs.Output(), "%s: wrong number of arguments\n", fs.Name())
+		fs.Usage()
+		return exitError, false
+	}
+
+	return exitOK, true
+}
+
+// batchFlags adds the flags of the subcommands that run a program to fs.
+// The returned function gives the options they select once fs is parsed.
+func batchFlags(fs *flag.FlagSet) func() (batchOptions, error) {
+	strict := fs.Bool("strict", false, "reject binary words that aren't 32 bits and operands outside the store")
+	maxSteps := fs.Int64("max-steps", 0, "stop after this many steps (0 for no limit)")
+	detectLoop := fs.Bool("detect-loop", false, "stop when the machine repeats an earlier state")
+	timing := fs.String("timing", "flat", "how simulated time is counted: flat or accurate")
+
+	return func() (batchOptions, error) {
+		tm, err := parseTiming(*timing)
+		if err != nil {
+			return batchOptions{}, err
+		}
+
+		return batchOptions{asm: assembler{strict: *strict}, maxSteps: *maxSteps, detectLoop: *detectLoop, timing: tm}, nil
+	}
+}
+
+// runCommandBatch runs the batch that options and err describe, reporting
+// any error to stderr, and returns its exit code.
+func runCommandBatch(opts batchOptions, err error, stdout, stderr io.Writer) int {
+	if err == nil {
+		err = runBatch(opts, stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+
+	return exitCode(err)
+}
+
+func cmdRun(fs *flag.FlagSet, args []string, stdout, stderr io.Writer) int {
+	options := batchFlags(fs)
+	plot := fs.String("plot", "", "path to write a CSV of the accumulator after each step to")
+	if code, ok := parseArgs(fs, args, 1); !ok {
+		return code
+	}
+
+	opts, err := options()
+	opts.programfile, opts.plot = fs.Arg(0), *plot
+	return runCommandBatch(opts, err, stdout, stderr)
+}
+
+func cmdCompare(fs *flag.FlagSet, args []string, stdout, stderr io.Writer) int {
+	options := batchFlags(fs)
+	if code, ok := parseArgs(fs, args, 2); !ok {
+		return code
+	}
+
+	opts, err := options()
+	opts.programfile, opts.compare = fs.Arg(0), fs.Arg(1)
+	return runCommandBatch(opts, err, stdout, stderr)
+}
+
+func cmdAssemble(fs *flag.FlagSet, args []string, stdout, stderr io.Writer) int {
+	strict := fs.Bool("strict", false, "reject binary words that aren't 32 bits and operands outside the store")
+	listing := fs.Bool("listing", false, "print an assembler listing instead, with source lines and statistics")
+	full := fs.Bool("full", false, "print all 32 words, zeros included")
+	if code, ok := parseArgs(fs, args, 1); !ok {
+		return code
+	}
+
+	p, err := assembler{strict: *strict}.assembleFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitLoad
+	}
+
+	switch {
+	case *listing:
+		err = p.writeListing(stdout)
+	case *full:
+		_, err = io.WriteString(stdout, p.mem.ToFullBinary())
+	default:
+		_, err = io.WriteString(stdout, p.mem.ToBinary())
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+func cmdDisasm(fs *flag.FlagSet, args []string, stdout, stderr io.Writer) int {
+	listing := fs.Bool("listing", false, "give each word's binary encoding alongside as a comment")
+	if code, ok := parseArgs(fs, args, 1); !ok {
+		return code
+	}
+
+	p, err := assembleFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitLoad
+	}
+
+	text := p.mem.ToAssembly()
+	if *listing {
+		text = p.mem.ToListing()
+	}
+	if _, err := io.WriteString(stdout, text); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+func cmdLint(fs *flag.FlagSet, args []string, stdout, stderr io.Writer) int {
+	strict := fs.Bool("strict", false, "reject binary words that aren't 32 bits and operands outside the store")
+	if code, ok := parseArgs(fs, args, 1); !ok {
+		return code
+	}
+
+	return exitCode(checkProgram(assembler{strict: *strict}, "", fs.Arg(0), stdout))
+}
+
+func cmdSelfTest(fs *flag.FlagSet, args []string, stdout, stderr io.Writer) int {
+	n := fs.Int64("n", highestFactorInput, "the number to find the highest factor of")
+	maxSteps := fs.Int64("max-steps", highestFactorSteps, "give up once this many steps have been executed (0 for no limit)")
+	if code, ok := parseArgs(fs, args, 0); !ok {
+		return code
+	}
+
+	if err := selfTest(*n, *maxSteps, stdout); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCode(err)
+	}
+
+	return exitOK
+}
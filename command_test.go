@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDispatchCommand(t *testing.T) {
+	stop := writeProgram(t, "0001 LDN 5\n0002 STO 6\n0003 STP\n0005 NUM 3\n")
+	stopped := writeProgram(t, "0001 LDN 5\n0002 STO 6\n0003 STP\n0005 NUM 3\n0006 NUM -3\n")
+	overwrite := writeProgram(t, "0001 LDN 5\n0001 STP\n")
+	bad := writeProgram(t, "0001 LDN\n")
+
+	cases := []struct {
+		args     []string
+		wantCode int
+		wantOut  string // a line the output must contain
+	}{
+		{[]string{"run", stop}, exitOK, "ci: 3, acc: -3, cycles: 3\n"},
+		{[]string{"run", "-max-steps", "2", stop}, exitMaxSteps, ""},
+		{[]string{"run", "-timing", "slow", stop}, exitError, ""},
+		{[]string{"run", bad}, exitLoad, ""},
+		{[]string{"run"}, exitError, ""},
+		{[]string{"run", "-h"}, exitOK, ""},
+		{[]string{"compare", stop, stopped}, exitOK, "ci: 3, acc: -3, cycles: 3\n"},
+		{[]string{"compare", stop, stop}, exitMismatch, "0006: got -3, want 0\n"},
+		{[]string{"compare", stop}, exitError, ""},
+		{[]string{"assemble", stop}, exitOK, "0003:00000000000001110000000000000000\n"},
+		{[]string{"assemble", "-listing", stop}, exitOK, "0003:00000000000001110000000000000000 | STP          ; line 3\n"},
+		{[]string{"assemble", "-full", stop}, exitOK, "0031:00000000000000000000000000000000\n"},
+		{[]string{"assemble", bad}, exitLoad, ""},
+		{[]string{"disasm", stop}, exitOK, "0002 STO 6\n"},
+		{[]string{"disasm", "-listing", stop}, exitOK, "0002 STO 6        ; 0002:01100000000001100000000000000000\n"},
+		{[]string{"lint", stop}, exitOK, ""},
+		{[]string{"lint", overwrite}, exitError, overwrite + ":2: overwrites store line 1, set on line 1\n"},
+		{[]string{"lint", "-strict", bad}, exitLoad, ""},
+		{[]string{"selftest", "-n", "91"}, exitOK, "highest factor of 91: 13, in 1460 steps\n"},
+		{[]string{"selftest", "-n", "1"}, exitError, ""},
+		{[]string{"selftest", "-n", "2147483647", "-max-steps", "1000"}, exitMaxSteps, ""},
+		{[]string{"selftest", stop}, exitError, ""},
+	}
+
+	for i, tc := range cases {
+		var out strings.Builder
+		code, ok := dispatchCommand(tc.args, &out, io.Discard)
+		if !ok || code != tc.wantCode {
+			t.Errorf("case %d: dispatchCommand(%q) = %d, %t, want %d, true", i, tc.args, code, ok, tc.wantCode)
+		}
+		if !strings.Contains(out.String(), tc.wantOut) {
+			t.Errorf("case %d: output %q doesn't contain %q", i, out.String(), tc.wantOut)
+		}
+	}
+
+	// Anything else is left to the flags, as before subcommands.
+	for _, args := range [][]string{nil, {"-programfile", stop}, {"help"}} {
+		if _, ok := dispatchCommand(args, io.Discard, io.Discard); ok {
+			t.Errorf("dispatchCommand(%q) ran a command", args)
+		}
+	}
+}
+
+func TestSubcommandMain(t *testing.T) {
+	if got := runMain(t, "", "disasm", "test.baby"); !strings.HasPrefix(got, "0001 LDN 13\n") {
+		t.Errorf("disasm printed %q", got)
+	}
+	ran := runMain(t, "", "run", "-max-steps", "1000", "primes.baby")
+	flat := runMain(t, "", "-headless", "-max-steps", "1000", "-programfile", "primes.baby")
+	if ran != flat {
+		t.Errorf("run printed %q, -headless printed %q", ran, flat)
+	}
+}
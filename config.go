@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// defaultStepDelay is how long Run pauses between steps. It's short:
+// roughly 1.2 ms per instruction.
+const defaultStepDelay = time.Millisecond
+
+// Sleeper pauses Run between steps. Tests substitute one that doesn't
+// wait, to make runs fast and repeatable.
+type Sleeper interface {
+	Sleep(d time.Duration)
+}
+
+// realSleeper sleeps with time.Sleep.
+type realSleeper struct{}
+
+func (realSleeper) Sleep(d time.Duration) { time.Sleep(d) }
+
+// BabyConfig holds everything that can be set on a machine when it is
+// built. Zero values give the same machine as NewBaby.
+type BabyConfig struct {
+	Memory     memory
+	InitialACC int32 // accumulator value restored by Reset
+
+	MaxSteps     int64         // steps allowed before stopping; 0 for no limit
+	HistoryDepth int           // steps kept for StepBack; 0 for the default, negative for none
+	StepDelay    time.Duration // pause between steps in Run; 0 for the default
+	Sleeper      Sleeper       // takes the pause; nil for time.Sleep
+	Timing       timingModel   // how SimulatedDuration counts time
+
+	Trace             io.Writer // receives a line per step when non-nil
+	DetectLoops       bool      // stop when the machine repeats an earlier state
+	RecordAccumulator bool      // keep the accumulator after each step for WritePlot
+
+	OnStep     StepHook     // called after each step
+	OnMemWrite MemWriteHook // called for each write to the store
+	OnHalt     func()       // called when a run ends
+}
+
+// NewWithConfig returns a machine fully configured by cfg, ready to run
+// from the start of its store.
+func NewWithConfig(cfg BabyConfig) *baby {
+	b := &baby{running: true, mem: cfg.Memory, initialMem: cfg.Memory, hooksEnabled: true, displayN: 1}
+
+	b.SetInitialACC(cfg.InitialACC)
+	b.acc = b.initialACC
+	b.SetMaxSteps(cfg.MaxSteps)
+	if cfg.HistoryDepth == 0 {
+		cfg.HistoryDepth = defaultHistoryDepth
+	}
+	b.SetHistoryDepth(cfg.HistoryDepth)
+	b.stepDelay = cfg.StepDelay
+	if b.stepDelay <= 0 {
+		b.stepDelay = defaultStepDelay
+	}
+	b.sleeper = cfg.Sleeper
+	if b.sleeper == nil {
+		b.sleeper = realSleeper{}
+	}
+	b.SetTiming(cfg.Timing)
+	b.SetTraceWriter(cfg.Trace)
+	b.SetLoopDetection(cfg.DetectLoops)
+	b.RecordAccumulator(cfg.RecordAccumulator)
+	b.OnStep(cfg.OnStep)
+	b.OnMemWrite(cfg.OnMemWrite)
+	b.OnHalt(cfg.OnHalt)
+
+	return b
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestNewWithConfig(t *testing.T) {
+	var trace bytes.Buffer
+	b := NewWithConfig(BabyConfig{
+		Memory:            loopMem(),
+		InitialACC:        7,
+		MaxSteps:          10,
+		HistoryDepth:      3,
+		StepDelay:         time.Microsecond,
+		Trace:             &trace,
+		DetectLoops:       true,
+		RecordAccumulator: true,
+	})
+
+	if b.mem != loopMem() || b.initialMem != loopMem() {
+		t.Errorf("store not set")
+	}
+	if b.acc != 7 || b.initialACC != 7 {
+		t.Errorf("acc(%d), initialACC(%d) != 7", b.acc, b.initialACC)
+	}
+	if b.maxSteps != 10 || b.historyDepth != 3 || b.stepDelay != time.Microsecond {
+		t.Errorf("maxSteps(%d) != 10 || historyDepth(%d) != 3 || stepDelay(%v) != 1µs", b.maxSteps, b.historyDepth, b.stepDelay)
+	}
+	if b.trace != &trace || b.loops == nil || !b.recordACC || !b.running {
+		t.Errorf("trace set(%t), loops set(%t), recordACC(%t), running(%t), want all true", b.trace == &trace, b.loops != nil, b.recordACC, b.running)
+	}
+
+	b.Step()
+	if trace.Len() == 0 || len(b.accLog) != 1 || len(b.history) != 1 {
+		t.Errorf("step wasn't traced, recorded and remembered")
+	}
+}
+
+func TestNewWithConfigDefaults(t *testing.T) {
+	b := NewWithConfig(BabyConfig{})
+	if b.historyDepth != defaultHistoryDepth || b.stepDelay != defaultStepDelay || b.maxSteps != 0 {
+		t.Errorf("historyDepth(%d), stepDelay(%v), maxSteps(%d) aren't the defaults", b.historyDepth, b.stepDelay, b.maxSteps)
+	}
+	if b.trace != nil || b.loops != nil || b.recordACC {
+		t.Errorf("optional features enabled by default")
+	}
+
+	if b := NewWithConfig(BabyConfig{HistoryDepth: -1}); b.historyDepth != 0 {
+		t.Errorf("negative HistoryDepth gave a depth of %d, want 0", b.historyDepth)
+	}
+}
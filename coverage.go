@@ -0,0 +1,40 @@
+package main
+
+// ExecutionCoverage returns the fraction of the store's 32 lines executed
+// at least once since the last reset: 0 before any steps and 1 once every
+// line has run.
+func (b *baby) ExecutionCoverage() float64 {
+	hit := 0
+	for _, n := range b.addrCounts {
+		if n > 0 {
+			hit++
+		}
+	}
+
+	return float64(hit) / words
+}
+
+// DataCoverage returns the fraction of the store's 32 lines read or
+// written as operands since the last reset. Instructions that take no
+// operand, CMP and STP, don't count.
+func (b *baby) DataCoverage() float64 {
+	hit := 0
+	for i := range b.readCounts {
+		if b.readCounts[i] > 0 || b.writeCounts[i] > 0 {
+			hit++
+		}
+	}
+
+	return float64(hit) / words
+}
+
+// countAccess adds n to the read or write count of the line inst uses as
+// its operand.
+func (b *baby) countAccess(inst *instruction, n int64) {
+	switch inst.op {
+	case JMP, JRP, SUB, SUB2, LDN:
+		b.readCounts[inst.data] += n
+	case STO:
+		b.writeCounts[inst.data] += n
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestExecutionCoverage(t *testing.T) {
+	b := NewBaby(loopMem())
+	if got := b.ExecutionCoverage(); got != 0 {
+		t.Errorf("coverage before any steps = %v, want 0", got)
+	}
+
+	// loopMem stays on lines 1 and 2.
+	b.StepN(100)
+	if got := b.ExecutionCoverage(); got >= 0.5 || got != 2.0/words {
+		t.Errorf("coverage of a small loop = %v, want 2/32", got)
+	}
+
+	b.StepBack()
+	b.StepBack()
+	b.Reset()
+	if got := b.ExecutionCoverage(); got != 0 {
+		t.Errorf("coverage after Reset = %v, want 0", got)
+	}
+
+	// Subtract on every line, starting from line 0, then stop on the last.
+	var mem memory
+	for i := range mem {
+		mem[i] = (&instruction{op: SUB, data: 0}).toInt32()
+	}
+	mem[words-1] = (&instruction{op: STP}).toInt32()
+	b = NewBaby(mem)
+	b.SetCI(-1)
+	b.StepN(100)
+	if got := b.ExecutionCoverage(); got != 1 {
+		t.Errorf("coverage of every line = %v, want 1", got)
+	}
+}
+
+func TestExecutionCoverageStepBack(t *testing.T) {
+	b := NewBaby(breakMem())
+	b.StepN(3)
+	b.StepBack()
+	if got, want := b.ExecutionCoverage(), 2.0/words; got != want {
+		t.Errorf("coverage after stepping back = %v, want %v", got, want)
+	}
+}
+
+func TestDataCoverage(t *testing.T) {
+	cases := []struct {
+		src  string
+		want float64
+	}{
+		// Repeated arithmetic on the same two words. Line 0 isn't
+		// executed, as the machine fetches from ci+1.
+		{"NUM 0\nLDN a\nSUB b\nSUB b\nSUB b\nSTO r\nSTP\na: NUM 1\nb: NUM 2\nr: NUM 0\n", 3.0 / words},
+		// Summing a lookup table into a result.
+		{"NUM 0\nLDN t0\nSUB t1\nSUB t2\nSUB t3\nSTO r\nSTP\nt0: NUM 1\nt1: NUM 2\nt2: NUM 3\nt3: NUM 4\nr: NUM 0\n", 5.0 / words},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(memory{})
+		if err := b.CompileAndLoad(tc.src); err != nil {
+			t.Fatalf("case %d: CompileAndLoad: unexpected error: %v", i, err)
+		}
+		if got := b.DataCoverage(); got != 0 {
+			t.Errorf("case %d: coverage before any steps = %v, want 0", i, got)
+		}
+		b.StepN(100)
+		if got := b.DataCoverage(); got != tc.want {
+			t.Errorf("case %d: got(%v) != want(%v)", i, got, tc.want)
+		}
+		b.StepBack()
+		b.StepBack()
+		if got, want := b.DataCoverage(), tc.want-1.0/words; got != want {
+			t.Errorf("case %d: after undoing the store got(%v) != want(%v)", i, got, want)
+		}
+	}
+}
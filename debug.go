@@ -0,0 +1,335 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	breakpointHit     = errors.New("invalid step - stopped at a breakpoint")
+	watchpointHit     = errors.New("invalid step - stopped after a watched line was accessed")
+	protectedStore    = errors.New("invalid step - stopped before a store to a protected line")
+	breakConditionMet = errors.New("invalid step - stopped by a break condition")
+	breakPaused       = errors.New("invalid step - paused by a break condition")
+	notReached        = errors.New("invalid run - machine halted before reaching the address")
+	badBit            = errors.New("invalid bit - want 0 to 31")
+	notSettled        = errors.New("invalid run - machine halted before the accumulator settled")
+	badWindow         = errors.New("invalid window - want at least 1 step")
+	invariantViolated = errors.New("invalid state - invariant violated")
+)
+
+// watchKind says which accesses to a line trigger a watchpoint.
+type watchKind int
+
+const (
+	watchRead watchKind = 1 << iota
+	watchWrite
+)
+
+func (k watchKind) String() string {
+	switch k {
+	case watchRead:
+		return "r"
+	case watchWrite:
+		return "w"
+	default:
+		return "rw"
+	}
+}
+
+// AddBreakpoint stops execution before the instruction at addr runs.
+// Breakpoints are kept across Reset and Reboot.
+func (b *baby) AddBreakpoint(addr int32) error {
+	if addr < 0 || addr >= words {
+		return badAddress
+	}
+
+	if b.breakpoints == nil {
+		b.breakpoints = make(map[int32]bool)
+	}
+	b.breakpoints[addr] = true
+	return nil
+}
+
+// RemoveBreakpoint removes any breakpoint at addr.
+func (b *baby) RemoveBreakpoint(addr int32) {
+	delete(b.breakpoints, addr)
+}
+
+// Breakpoints returns the addresses with breakpoints, in order.
+func (b *baby) Breakpoints() []int32 {
+	return sortedAddrs(b.breakpoints)
+}
+
+// BreakOnCondition pauses execution after any step that leaves cond true,
+// calling the OnBreak hook. Unlike a halt condition this leaves the machine
+// running: steps fail with breakPaused until Resume is called. Conditions are
+// kept across Reset and Reboot.
+func (b *baby) BreakOnCondition(cond func(*baby) bool) {
+	b.breakConds = append(b.breakConds, cond)
+}
+
+// ClearBreakConditions removes every condition added by BreakOnCondition.
+func (b *baby) ClearBreakConditions() {
+	b.breakConds = nil
+}
+
+// Paused reports whether a break condition has paused execution.
+func (b *baby) Paused() bool {
+	return b.paused
+}
+
+// Resume lets execution continue after a break condition paused it.
+func (b *baby) Resume() {
+	b.paused = false
+}
+
+// breakConditionHit reports whether any break condition holds.
+func (b *baby) breakConditionHit() bool {
+	for _, cond := range b.breakConds {
+		if cond(b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddWatchpoint stops execution after an instruction reads or writes the
+// word at addr, as selected by kind. Watchpoints are kept across Reset
+// and Reboot.
+func (b *baby) AddWatchpoint(addr int32, kind watchKind) error {
+	if addr < 0 || addr >= words {
+		return badAddress
+	}
+
+	if b.watchpoints == nil {
+		b.watchpoints = make(map[int32]watchKind)
+	}
+	b.watchpoints[addr] |= kind
+	return nil
+}
+
+// AddBitWatch stops execution after a store to addr flips bit of the
+// word, counting from 0 for the least significant bit. Bit watches are
+// kept across Reset and Reboot.
+func (b *baby) AddBitWatch(addr int32, bit int) error {
+	if addr < 0 || addr >= words {
+		return badAddress
+	}
+	if bit < 0 || bit >= 32 {
+		return badBit
+	}
+
+	if b.bitWatches == nil {
+		b.bitWatches = make(map[int32]uint32)
+	}
+	b.bitWatches[addr] |= 1 << bit
+	return nil
+}
+
+// RemoveWatchpoint removes any watchpoint or bit watch on addr.
+func (b *baby) RemoveWatchpoint(addr int32) {
+	delete(b.watchpoints, addr)
+	delete(b.bitWatches, addr)
+}
+
+// BitWatches returns the watched bits of each line with a bit watch, in
+// order.
+func (b *baby) BitWatches() map[int32][]int {
+	w := make(map[int32][]int, len(b.bitWatches))
+	for addr, mask := range b.bitWatches {
+		for bit := 0; bit < 32; bit++ {
+			if mask&(1<<bit) != 0 {
+				w[addr] = append(w[addr], bit)
+			}
+		}
+	}
+
+	return w
+}
+
+// Watchpoints returns the watched addresses, in order, with the accesses
+// watched on each.
+func (b *baby) Watchpoints() map[int32]watchKind {
+	w := make(map[int32]watchKind, len(b.watchpoints))
+	for addr, k := range b.watchpoints {
+		w[addr] = k
+	}
+
+	return w
+}
+
+// Protect makes the lines from lo to hi, inclusive, read-only: a STO to
+// any of them stops before the instruction runs, returning protectedStore.
+// Protection is kept across Reset and Reboot and doesn't stop PokeMem.
+func (b *baby) Protect(lo, hi int32) error {
+	if lo < 0 || hi >= words || lo > hi {
+		return badAddress
+	}
+
+	for addr := lo; addr <= hi; addr++ {
+		b.protected[addr] = true
+	}
+	return nil
+}
+
+// Unprotect removes all protection from the store.
+func (b *baby) Unprotect() {
+	b.protected = [words]bool{}
+}
+
+// ProtectedRegions returns the protected ranges of lines, in order, as
+// pairs of their first and last lines.
+func (b *baby) ProtectedRegions() [][2]int32 {
+	var regions [][2]int32
+	for addr := int32(0); addr < words; addr++ {
+		if !b.protected[addr] {
+			continue
+		}
+		if n := len(regions); n > 0 && regions[n-1][1] == addr-1 {
+			regions[n-1][1] = addr
+		} else {
+			regions = append(regions, [2]int32{addr, addr})
+		}
+	}
+
+	return regions
+}
+
+// atBreakpoint reports whether the next instruction has a breakpoint that
+// hasn't yet stopped execution. Stopping at a breakpoint once lets the next
+// step run the instruction.
+func (b *baby) atBreakpoint() bool {
+	if b.breakpoints[int32(b.ci+1)] && !b.atBreak {
+		b.atBreak = true
+		return true
+	}
+
+	b.atBreak = false
+	return false
+}
+
+// watchHit returns watchpointHit if executing inst touched a watched line
+// or flipped a watched bit. before is the operand's word as it was before
+// inst executed.
+func (b *baby) watchHit(inst *instruction, before int32) error {
+	kind := b.watchpoints[inst.data]
+	switch inst.op {
+	case STO:
+		if kind&watchWrite != 0 {
+			return fmt.Errorf("%w: write to line %d", watchpointHit, inst.data)
+		}
+		if flipped := uint32(before^b.mem[inst.data]) & b.bitWatches[inst.data]; flipped != 0 {
+			return fmt.Errorf("%w: bit %d of line %d flipped", watchpointHit, lowestBit(flipped), inst.data)
+		}
+	case JMP, JRP, LDN, SUB, SUB2:
+		if kind&watchRead != 0 {
+			return fmt.Errorf("%w: read of line %d", watchpointHit, inst.data)
+		}
+	}
+
+	return nil
+}
+
+// lowestBit returns the index of the least significant set bit of m, which
+// must be non-zero.
+func lowestBit(m uint32) int {
+	bit := 0
+	for m&1 == 0 {
+		m >>= 1
+		bit++
+	}
+
+	return bit
+}
+
+// StepN executes up to n steps, stopping early if the machine stops or a
+// step returns an error. It returns the number of steps executed.
+func (b *baby) StepN(n int) (int, error) {
+	start := b.cycles
+	for i := 0; i < n && b.running; i++ {
+		if _, err := b.Step(); err != nil {
+			return int(b.cycles - start), err
+		}
+	}
+
+	return int(b.cycles - start), nil
+}
+
+// StepUntilAddress steps until the instruction at addr has executed,
+// returning the number of steps taken, including that one. It gives up
+// with tooManySteps after maxSteps steps, or notReached if the machine
+// stops first. Unlike Run, nothing is displayed.
+func (b *baby) StepUntilAddress(addr int32, maxSteps int) (int, error) {
+	if addr < 0 || addr >= words {
+		return 0, badAddress
+	}
+
+	start := b.cycles
+	for int(b.cycles-start) < maxSteps {
+		if !b.running {
+			return int(b.cycles - start), notReached
+		}
+		if _, err := b.Step(); err != nil {
+			return int(b.cycles - start), err
+		}
+		if b.last == addr {
+			return int(b.cycles - start), nil
+		}
+	}
+
+	return int(b.cycles - start), tooManySteps
+}
+
+// RunUntilStable steps until the accumulator has been left unchanged by
+// the last window steps, returning the number of steps taken. It gives up
+// with tooManySteps after maxSteps steps, or notSettled if the machine stops
+// first. Unlike Run, nothing is displayed.
+func (b *baby) RunUntilStable(window, maxSteps int) (int, error) {
+	if window < 1 {
+		return 0, badWindow
+	}
+
+	start := b.cycles
+	unchanged := 0
+	for int(b.cycles-start) < maxSteps {
+		if !b.running {
+			return int(b.cycles - start), notSettled
+		}
+		acc := b.acc
+		if _, err := b.Step(); err != nil {
+			return int(b.cycles - start), err
+		}
+		if b.acc != acc {
+			unchanged = 0
+			continue
+		}
+		if unchanged++; unchanged >= window {
+			return int(b.cycles - start), nil
+		}
+	}
+
+	return int(b.cycles - start), tooManySteps
+}
+
+// VerifyInvariant returns invariantViolated if inv doesn't hold for the
+// machine. Call it from an OnStep hook to check inv after every step.
+func (b *baby) VerifyInvariant(inv func(*baby) bool) error {
+	if !inv(b) {
+		return invariantViolated
+	}
+
+	return nil
+}
+
+func sortedAddrs[V any](m map[int32]V) []int32 {
+	addrs := make([]int32, 0, len(m))
+	for addr := range m {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	return addrs
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// breakMem returns a store whose third step executes line 5.
+func breakMem() memory {
+	var mem memory
+	mem[1] = (&instruction{op: LDN, data: 20}).toInt32()
+	mem[2] = (&instruction{op: JMP, data: 21}).toInt32()
+	mem[5] = (&instruction{op: STO, data: 22}).toInt32()
+	mem[6] = (&instruction{op: STP}).toInt32()
+	mem[20] = 9
+	mem[21] = 4
+	return mem
+}
+
+func TestBreakpoint(t *testing.T) {
+	b := NewBaby(breakMem())
+	out := runREPL(t, b, "K +5\nS\nS\nS\nQ\n")
+	if b.cycles != 2 || b.ci != 4 {
+		t.Errorf("cycles(%d) != 2 || ci(%d) != 4", b.cycles, b.ci)
+	}
+	if !strings.Contains(out, breakpointHit.Error()) {
+		t.Errorf("breakpoint not reported:\n%s", out)
+	}
+
+	// Stepping again runs the instruction at the breakpoint.
+	if inst, err := b.Step(); err != nil || inst.op != STO {
+		t.Errorf("step past breakpoint = %v, %v, want STO 22", inst, err)
+	}
+
+	// Breakpoints survive Reset and Reboot, and stop Run.
+	b.Reset()
+	b.Reboot(breakMem())
+	b.ConnectTerminal(strings.NewReader(""), &strings.Builder{})
+	b.Run()
+	if b.cycles != 2 || !b.running {
+		t.Errorf("Run didn't stop at the breakpoint: cycles(%d), running(%t)", b.cycles, b.running)
+	}
+
+	runREPL(t, b, "K -5\nK +6\nK +1\nQ\n")
+	if got, want := b.Breakpoints(), []int32{1, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Breakpoints() = %v, want %v", got, want)
+	}
+	if out := runREPL(t, b, "K\nQ\n"); !strings.Contains(out, "break 0001\nbreak 0006\n") {
+		t.Errorf("breakpoints not listed:\n%s", out)
+	}
+
+	// A reset machine stops at a breakpoint again, even one it just
+	// stopped at.
+	b.Reset()
+	if _, err := b.Step(); !errors.Is(err, breakpointHit) {
+		t.Fatalf("first step = %v, want %v", err, breakpointHit)
+	}
+	b.Reset()
+	if _, err := b.Step(); !errors.Is(err, breakpointHit) || b.cycles != 0 {
+		t.Errorf("first step after Reset = %v at cycle %d, want %v at cycle 0", err, b.cycles, breakpointHit)
+	}
+	if !strings.HasSuffix(b.FormatInstruction(6), " | breakpoint") || strings.Contains(b.FormatInstruction(5), "breakpoint") {
+		t.Errorf("FormatInstruction doesn't flag breakpoints: %q, %q", b.FormatInstruction(6), b.FormatInstruction(5))
+	}
+}
+
+func TestWatchpoint(t *testing.T) {
+	cases := []struct {
+		cmd        string
+		wantCycles int64
+	}{
+		{"W +20 r", 1},
+		{"W +22 w", 3},
+		{"W +22 r", 4},
+		{"W +21 r", 2},
+		{"W +21 w", 4},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(breakMem())
+		runREPL(t, b, tc.cmd+"\nQ\n")
+
+		var err error
+		for b.running && err == nil {
+			_, err = b.Step()
+		}
+		if b.cycles != tc.wantCycles {
+			t.Errorf("case %d: stopped after %d cycles, want %d", i, b.cycles, tc.wantCycles)
+		}
+		if tc.wantCycles < 4 && !errors.Is(err, watchpointHit) {
+			t.Errorf("case %d: err(%v) != wantErr(%v)", i, err, watchpointHit)
+		}
+	}
+
+	b := NewBaby(breakMem())
+	runREPL(t, b, "W +20 r\nW +20 w\nW +3 w\nW -3\nQ\n")
+	if got, want := b.Watchpoints(), map[int32]watchKind{20: watchRead | watchWrite}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Watchpoints() = %v, want %v", got, want)
+	}
+	if out := runREPL(t, b, "W\nQ\n"); !strings.Contains(out, "watch 0020 rw\n") {
+		t.Errorf("watchpoints not listed:\n%s", out)
+	}
+
+	for _, bad := range []string{"W +20", "W 20 r", "W +20 x", "W +32 r", "W +20 b32", "W +20 bx", "W +20 b", "K 5", "K +x", "K +5 6"} {
+		b := NewBaby(breakMem())
+		if out := runREPL(t, b, bad+"\nQ\n"); !strings.Contains(out, "usage:") {
+			t.Errorf("%q printed no error:\n%s", bad, out)
+		}
+		if len(b.breakpoints) != 0 || len(b.watchpoints) != 0 || len(b.bitWatches) != 0 {
+			t.Errorf("%q added a breakpoint or watchpoint", bad)
+		}
+	}
+}
+
+// bitMem returns a store that writes 8 and then 9 to line 22, setting bit
+// 3 on its 2nd step and bit 0 on its 4th, and stops on its 5th.
+func bitMem() memory {
+	var mem memory
+	mem[1] = (&instruction{op: LDN, data: 20}).toInt32()
+	mem[2] = (&instruction{op: STO, data: 22}).toInt32()
+	mem[3] = (&instruction{op: LDN, data: 21}).toInt32()
+	mem[4] = (&instruction{op: STO, data: 22}).toInt32()
+	mem[5] = (&instruction{op: STP}).toInt32()
+	mem[20] = -8
+	mem[21] = -9
+	return mem
+}
+
+func TestBitWatch(t *testing.T) {
+	cases := []struct {
+		cmd        string
+		wantCycles int64
+	}{
+		{"W +22 b3", 2},
+		{"W +22 b0", 4},
+		{"W +22 B0", 4},
+		{"W +22 b5", 5},
+		{"W +21 b0", 5},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(bitMem())
+		runREPL(t, b, tc.cmd+"\nQ\n")
+
+		var err error
+		for b.running && err == nil {
+			_, err = b.Step()
+		}
+		if b.cycles != tc.wantCycles {
+			t.Errorf("case %d: stopped after %d cycles, want %d", i, b.cycles, tc.wantCycles)
+		}
+		if tc.wantCycles < 5 && !errors.Is(err, watchpointHit) {
+			t.Errorf("case %d: err(%v) != wantErr(%v)", i, err, watchpointHit)
+		}
+	}
+
+	// Storing the same value again flips nothing.
+	b := NewBaby(bitMem())
+	b.mem[21] = -8
+	b.AddBitWatch(22, 3)
+	b.StepN(2)
+	if _, err := b.StepN(3); err != nil || b.cycles != 5 {
+		t.Errorf("rewriting a watched bit stopped after %d cycles: %v", b.cycles, err)
+	}
+
+	b = NewBaby(bitMem())
+	runREPL(t, b, "W +22 b3\nW +22 b0\nW +20 w\nQ\n")
+	if got, want := b.BitWatches(), map[int32][]int{22: {0, 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BitWatches() = %v, want %v", got, want)
+	}
+	if out := runREPL(t, b, "W\nQ\n"); !strings.Contains(out, "watch 0020 w\nwatch 0022 b0\nwatch 0022 b3\n") {
+		t.Errorf("bit watches not listed:\n%s", out)
+	}
+	runREPL(t, b, "W -22\nQ\n")
+	if len(b.BitWatches()) != 0 {
+		t.Errorf("W -22 left bit watches: %v", b.BitWatches())
+	}
+
+	if err := b.AddBitWatch(22, -1); err != badBit {
+		t.Errorf("AddBitWatch(22, -1) = %v, want %v", err, badBit)
+	}
+	if err := b.AddBitWatch(32, 0); err != badAddress {
+		t.Errorf("AddBitWatch(32, 0) = %v, want %v", err, badAddress)
+	}
+}
+
+func TestProtect(t *testing.T) {
+	b := NewBaby(bitMem())
+	if err := b.Protect(20, 25); err != nil {
+		t.Fatalf("Protect(20, 25): unexpected error: %v", err)
+	}
+
+	b.Step()
+	inst, err := b.Step()
+	if !errors.Is(err, protectedStore) || inst.op != STO {
+		t.Fatalf("store to a protected line = %v, %v, want %v", inst, err, protectedStore)
+	}
+	if b.mem != bitMem() || b.cycles != 1 || b.ci != 1 {
+		t.Errorf("blocked store changed the machine: cycles(%d), ci(%d), mem[22](%d)", b.cycles, b.ci, b.mem[22])
+	}
+
+	// Protection outlasts a reset, and pokes still work.
+	b.Reset()
+	if _, err := b.StepN(5); !errors.Is(err, protectedStore) {
+		t.Errorf("after Reset StepN() = %v, want %v", err, protectedStore)
+	}
+	if _, err := b.PokeMem(22, 1); err != nil || b.mem[22] != 1 {
+		t.Errorf("PokeMem(22, 1) to a protected line = %v", err)
+	}
+
+	b.Unprotect()
+	if n, err := b.StepN(5); err != nil || b.running {
+		t.Errorf("after Unprotect ran %d steps: %v", n, err)
+	}
+
+	for _, r := range [][2]int32{{-1, 5}, {5, 32}, {6, 5}} {
+		if err := b.Protect(r[0], r[1]); err != badAddress {
+			t.Errorf("Protect(%d, %d) = %v, want %v", r[0], r[1], err, badAddress)
+		}
+	}
+	if len(b.ProtectedRegions()) != 0 {
+		t.Errorf("bad ranges were protected: %v", b.ProtectedRegions())
+	}
+
+	b = NewBaby(bitMem())
+	out := runREPL(t, b, "protect 20 25\nprotect 28 28\nprotect 26 26\nprotect\nprotect 5\nprotect 6 5\nQ\n")
+	if want := [][2]int32{{20, 26}, {28, 28}}; !reflect.DeepEqual(b.ProtectedRegions(), want) {
+		t.Errorf("ProtectedRegions() = %v, want %v", b.ProtectedRegions(), want)
+	}
+	if !strings.Contains(out, "protect 0020 0026\nprotect 0028 0028\n") {
+		t.Errorf("protected lines not listed:\n%s", out)
+	}
+	if strings.Count(out, "usage: protect") != 2 {
+		t.Errorf("bad ranges not reported:\n%s", out)
+	}
+	out = runREPL(t, b, "R\nunprotect\nprotect\nQ\n")
+	if !strings.Contains(out, "store to line 22") {
+		t.Errorf("run didn't report the blocked store:\n%s", out)
+	}
+	if len(b.ProtectedRegions()) != 0 {
+		t.Errorf("unprotect left %v", b.ProtectedRegions())
+	}
+}
+
+// countdownMem returns a store that loops back to line 2 once, then stops
+// by executing line 5 on its 7th step.
+func countdownMem() memory {
+	var mem memory
+	mem[1] = (&instruction{op: LDN, data: 20}).toInt32()
+	mem[2] = (&instruction{op: SUB, data: 21}).toInt32()
+	mem[3] = (&instruction{op: CMP}).toInt32()
+	mem[4] = (&instruction{op: JMP, data: 22}).toInt32()
+	mem[5] = (&instruction{op: STP}).toInt32()
+	mem[20] = -1
+	mem[21] = 1
+	mem[22] = 1
+	return mem
+}
+
+func TestBreakOnCondition(t *testing.T) {
+	b := NewBaby(loopMem())
+	var breaks []int64
+	b.OnBreak(func(b *baby) { breaks = append(breaks, b.cycles) })
+	b.BreakOnCondition(func(b *baby) bool { return b.cycles == 10 })
+
+	n, err := b.StepN(100)
+	if n != 10 || !errors.Is(err, breakConditionMet) {
+		t.Fatalf("StepN(100) = %d, %v, want 10, %v", n, err, breakConditionMet)
+	}
+	if !b.Paused() || !b.running || b.HaltReason() != HaltNone || !reflect.DeepEqual(breaks, []int64{10}) {
+		t.Errorf("at the break paused(%t), running(%t), HaltReason() = %v, breaks %v; want paused at cycle 10", b.Paused(), b.running, b.HaltReason(), breaks)
+	}
+
+	// Paused, nothing runs until Resume.
+	if inst, err := b.Step(); inst != nil || err != breakPaused || b.cycles != 10 {
+		t.Errorf("Step() while paused = %v, %v at cycle %d, want nil, %v at cycle 10", inst, err, b.cycles, breakPaused)
+	}
+	b.Resume()
+	if n, err := b.StepN(10); n != 10 || err != nil || b.Paused() {
+		t.Errorf("after Resume StepN(10) = %d, %v, paused(%t), want 10, nil, false", n, err, b.Paused())
+	}
+
+	// Any condition breaks, and a hook that resumes carries straight on.
+	// acc reaches -8 at cycle 15 and keeps it for the JMP at cycle 16.
+	b.BreakOnCondition(func(b *baby) bool { return b.acc == -8 })
+	b.OnBreak(func(b *baby) {
+		breaks = append(breaks, b.cycles)
+		b.Resume()
+	})
+	b.Reset()
+	breaks = nil
+	if n, err := b.StepN(20); n != 20 || err != nil {
+		t.Errorf("StepN(20) = %d, %v, want 20, nil", n, err)
+	}
+	if !reflect.DeepEqual(breaks, []int64{10, 15, 16}) {
+		t.Errorf("broke at %v, want [10 15 16]", breaks)
+	}
+
+	b.ClearBreakConditions()
+	b.Reset()
+	breaks = nil
+	if n, err := b.StepN(30); n != 30 || err != nil || breaks != nil {
+		t.Errorf("without conditions StepN(30) = %d, %v, breaks %v", n, err, breaks)
+	}
+}
+
+func TestBreakConditionClone(t *testing.T) {
+	b := NewBaby(loopMem())
+	calls := 0
+	b.OnBreak(func(b *baby) { calls++ })
+	b.BreakOnCondition(func(b *baby) bool { return true })
+
+	want := b.RegisterState()
+	b.Trace(5)
+	b.SimulateStep()
+	if calls != 0 {
+		t.Errorf("Trace and SimulateStep called OnBreak %d times, want 0", calls)
+	}
+	if got := b.RegisterState(); got != want || b.Paused() {
+		t.Errorf("after Trace and SimulateStep registers %+v, paused(%t), want %+v, false", got, b.Paused(), want)
+	}
+	if got := b.Trace(5); strings.Count(got, "\n") != 5 {
+		t.Errorf("Trace(5) = %q, want 5 steps", got)
+	}
+}
+
+func TestStepN(t *testing.T) {
+	cases := []struct {
+		n, want int
+		running bool
+	}{
+		{0, 0, true},
+		{3, 3, true},
+		{7, 7, false},
+		{100, 7, false},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(countdownMem())
+		got, err := b.StepN(tc.n)
+		if got != tc.want || err != nil || b.running != tc.running {
+			t.Errorf("case %d: StepN(%d) = %d, %v, running(%t), want %d, nil, running(%t)", i, tc.n, got, err, b.running, tc.want, tc.running)
+		}
+	}
+
+	b := NewBaby(countdownMem())
+	b.AddBreakpoint(4)
+	if got, err := b.StepN(10); got != 3 || err != breakpointHit {
+		t.Errorf("StepN to a breakpoint = %d, %v, want 3, %v", got, err, breakpointHit)
+	}
+}
+
+func TestStepUntilAddress(t *testing.T) {
+	cases := []struct {
+		addr     int32
+		maxSteps int
+		want     int
+		wantErr  error
+	}{
+		{5, 100, 7, nil},
+		{4, 100, 4, nil},
+		{2, 100, 2, nil},
+		{5, 6, 6, tooManySteps},
+		{10, 100, 7, notReached},
+		{32, 100, 0, badAddress},
+		{-1, 100, 0, badAddress},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(countdownMem())
+		got, err := b.StepUntilAddress(tc.addr, tc.maxSteps)
+		if got != tc.want || err != tc.wantErr {
+			t.Errorf("case %d: StepUntilAddress(%d, %d) = %d, %v, want %d, %v", i, tc.addr, tc.maxSteps, got, err, tc.want, tc.wantErr)
+		}
+	}
+
+	// Each call runs on to the next time the address executes.
+	b := NewBaby(countdownMem())
+	b.StepUntilAddress(2, 100)
+	if got, err := b.StepUntilAddress(2, 100); got != 3 || err != nil {
+		t.Errorf("second StepUntilAddress(2) = %d, %v, want 3, nil", got, err)
+	}
+}
+
+// stableMem returns a store that loads -3 on its first step and then loops
+// storing and reloading it, leaving the accumulator unchanged.
+func stableMem() memory {
+	var mem memory
+	mem[1] = (&instruction{op: LDN, data: 20}).toInt32()
+	mem[2] = (&instruction{op: STO, data: 22}).toInt32()
+	mem[3] = (&instruction{op: JMP, data: 23}).toInt32()
+	mem[20] = 3
+	return mem
+}
+
+func TestRunUntilStable(t *testing.T) {
+	cases := []struct {
+		mem      memory
+		window   int
+		maxSteps int
+		want     int
+		wantErr  error
+	}{
+		{stableMem(), 5, 100, 6, nil},
+		{stableMem(), 1, 100, 2, nil},
+		{stableMem(), 5, 4, 4, tooManySteps},
+		{loopMem(), 1, 100, 2, nil},
+		{loopMem(), 2, 50, 50, tooManySteps},
+		{countdownMem(), 100, 100, 7, notSettled},
+		{stableMem(), 0, 100, 0, badWindow},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(tc.mem)
+		got, err := b.RunUntilStable(tc.window, tc.maxSteps)
+		if got != tc.want || err != tc.wantErr {
+			t.Errorf("case %d: RunUntilStable(%d, %d) = %d, %v, want %d, %v", i, tc.window, tc.maxSteps, got, err, tc.want, tc.wantErr)
+		}
+	}
+
+	b := NewBaby(stableMem())
+	out := runREPL(t, b, "run-until-stable 5\nrun-until-stable x\nQ\n")
+	if b.cycles != 6 || !strings.Contains(out, "acc stable at -3 after 6 steps") {
+		t.Errorf("run-until-stable 5 ran %d steps:\n%s", b.cycles, out)
+	}
+	if !strings.Contains(out, "usage: run-until-stable") {
+		t.Errorf("bad window not reported:\n%s", out)
+	}
+}
+
+func TestVerifyInvariant(t *testing.T) {
+	b := NewBaby(loopMem()) // The acc goes down by one every other step.
+	accAboveMinus3 := func(b *baby) bool { return b.acc > -3 }
+
+	if err := b.VerifyInvariant(accAboveMinus3); err != nil {
+		t.Errorf("VerifyInvariant() before running = %v, want nil", err)
+	}
+
+	var failed error
+	b.OnStep(func(*instruction) {
+		if err := b.VerifyInvariant(accAboveMinus3); err != nil && failed == nil {
+			failed = err
+			b.running = false
+		}
+	})
+	b.StepN(100)
+	if failed != invariantViolated || b.acc != -3 || b.cycles != 5 {
+		t.Errorf("invariant failure = %v at acc %d, cycle %d, want %v at acc -3, cycle 5", failed, b.acc, b.cycles, invariantViolated)
+	}
+}
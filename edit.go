@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var (
+	noEditor = errors.New("invalid editor - EDITOR is not set")
+)
+
+// EditStore writes the store out as assembly, opens it in editor and then
+// loads the edited program back into the store. The registers are left
+// alone so a running program can be patched. If the edited program fails
+// to assemble the store is unchanged.
+func (b *baby) EditStore(editor string) error {
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		return noEditor
+	}
+
+	f, err := os.CreateTemp("", "baby-*.baby")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(b.mem.ToAssembly()); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing temporary file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing temporary file: %v", err)
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running editor: %v", err)
+	}
+
+	mem, err := loadProgram(f.Name())
+	if err != nil {
+		return err
+	}
+	b.mem = mem
+	b.source, b.labels = nil, nil // The edited source is gone once we return.
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeEditor edits the file at path as an editor would, replacing the
+// text before "=>" in edit with the text after it, and returns the exit
+// status. TestMain runs it when the test binary is used as EDITOR.
+func fakeEditor(edit, path string) int {
+	old, repl, _ := strings.Cut(edit, "=>")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = os.WriteFile(path, []byte(strings.Replace(string(data), old, repl, 1)), 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func TestEditStore(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+
+	t.Setenv("BABY_TEST_EDIT", "0002 SUB 14\n=>0002 SUB 15\n")
+
+	b := NewBaby(mem)
+	b.Step()
+	if err := b.EditStore(os.Args[0]); err != nil {
+		t.Fatalf("EditStore: unexpected error: %v", err)
+	}
+
+	want := mem
+	want[2] = (&instruction{op: SUB, data: 15}).toInt32()
+	if b.mem != want {
+		t.Errorf("store after edit = %v, want %v", b.mem, want)
+	}
+	if b.ci != 1 {
+		t.Errorf("ci = %d after edit, want 1", b.ci)
+	}
+}
+
+func TestEditStoreNoEditor(t *testing.T) {
+	b := NewBaby(loopMem())
+	if err := b.EditStore(""); err != noEditor {
+		t.Errorf("err(%v) != wantErr(%v)", err, noEditor)
+	}
+	if b.mem != loopMem() {
+		t.Errorf("store modified without an editor")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+// HaltReason says why the machine last stopped running.
+type HaltReason int
+
+const (
+	HaltNone         HaltReason = iota // still running, or stopped some other way
+	HaltStop                           // executed a STP
+	HaltMaxSteps                       // reached the step limit
+	HaltLoop                           // loop detection saw a repeated state
+	HaltCondition                      // a registered halt condition held
+	HaltAddressError                   // ci left the store; see LastError
+)
+
+func (r HaltReason) String() string {
+	switch r {
+	case HaltStop:
+		return "stop instruction"
+	case HaltMaxSteps:
+		return "step limit"
+	case HaltLoop:
+		return "loop"
+	case HaltCondition:
+		return "halt condition"
+	case HaltAddressError:
+		return "address error"
+	default:
+		return "none"
+	}
+}
+
+// haltCondition is a condition registered by RegisterHaltCondition.
+type haltCondition struct {
+	cond func(*baby) bool
+	msg  string
+}
+
+// RegisterHaltCondition stops the machine after any step that leaves cond
+// true, with HaltReason HaltCondition and HaltMessage msg. Conditions are
+// checked in the order registered and are kept across Reset and Reboot.
+func (b *baby) RegisterHaltCondition(cond func(*baby) bool, msg string) {
+	b.haltConds = append(b.haltConds, haltCondition{cond, msg})
+}
+
+// HaltReason returns why the machine last stopped, or HaltNone if it
+// hasn't since the last reset.
+func (b *baby) HaltReason() HaltReason {
+	return b.haltReason
+}
+
+// HaltMessage returns the message of the halt condition that last stopped
+// the machine, or "" if it wasn't stopped by one.
+func (b *baby) HaltMessage() string {
+	return b.haltMsg
+}
+
+// LastError returns the error that stopped the machine with
+// HaltAddressError, or nil if it hasn't been stopped by one since the last
+// reset.
+func (b *baby) LastError() error {
+	return b.lastError
+}
+
+// halt stops the machine, recording why.
+func (b *baby) halt(r HaltReason, msg string) {
+	b.running = false
+	b.haltReason, b.haltMsg = r, msg
+}
+
+// clearHalt forgets why the machine last stopped, once it can run again.
+func (b *baby) clearHalt() {
+	b.haltReason, b.haltMsg, b.lastError = HaltNone, "", nil
+}
+
+// checkHaltConditions halts the machine if any registered condition holds.
+func (b *baby) checkHaltConditions() {
+	for _, c := range b.haltConds {
+		if c.cond(b) {
+			b.halt(HaltCondition, c.msg)
+			return
+		}
+	}
+}
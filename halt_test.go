@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegisterHaltCondition(t *testing.T) {
+	b := NewWithConfig(BabyConfig{Memory: loopMem(), Sleeper: &fakeSleeper{}})
+	var out strings.Builder
+	b.ConnectTerminal(strings.NewReader(""), &out)
+	b.RegisterHaltCondition(func(b *baby) bool { return b.acc < -100 }, "acc below -100")
+	b.RegisterHaltCondition(func(b *baby) bool { return b.cycles == 5 }, "cycle 5")
+	b.RegisterHaltCondition(func(b *baby) bool { return b.cycles >= 5 }, "cycle 5 or later")
+
+	b.Run()
+	if b.cycles != 5 || b.running {
+		t.Errorf("Run stopped after %d cycles, running %t, want 5 and stopped", b.cycles, b.running)
+	}
+	if b.HaltReason() != HaltCondition || b.HaltMessage() != "cycle 5" {
+		t.Errorf("HaltReason() = %v, HaltMessage() = %q, want %v and \"cycle 5\"", b.HaltReason(), b.HaltMessage(), HaltCondition)
+	}
+	if !strings.Contains(out.String(), "halted: cycle 5\n") {
+		t.Errorf("Run didn't report the halt condition:\n%s", out.String())
+	}
+
+	// Conditions outlast a reset, which clears the reason.
+	b.Reset()
+	if b.HaltReason() != HaltNone || b.HaltMessage() != "" {
+		t.Errorf("after Reset HaltReason() = %v, HaltMessage() = %q", b.HaltReason(), b.HaltMessage())
+	}
+	if n, err := b.StepN(100); n != 5 || err != nil {
+		t.Errorf("StepN(100) = %d, %v, want 5, nil", n, err)
+	}
+
+	// Stepping back past the halt leaves the machine running again.
+	b.StepBack()
+	if !b.running || b.HaltReason() != HaltNone {
+		t.Errorf("after StepBack running(%t), HaltReason() = %v", b.running, b.HaltReason())
+	}
+}
+
+func TestHaltReason(t *testing.T) {
+	var stop memory
+	stop[1] = (&instruction{op: STP}).toInt32()
+
+	cases := []struct {
+		cfg  BabyConfig
+		want HaltReason
+	}{
+		{BabyConfig{Memory: stop}, HaltStop},
+		{BabyConfig{Memory: loopMem(), MaxSteps: 10}, HaltMaxSteps},
+		{BabyConfig{Memory: loopMem(), MaxSteps: 10, DetectLoops: true}, HaltMaxSteps},
+		{BabyConfig{Memory: stableMem(), MaxSteps: 100, DetectLoops: true}, HaltLoop},
+	}
+
+	for i, tc := range cases {
+		b := NewWithConfig(tc.cfg)
+		if b.HaltReason() != HaltNone {
+			t.Errorf("case %d: before running HaltReason() = %v", i, b.HaltReason())
+		}
+		for b.running {
+			b.Step()
+		}
+		if got := b.HaltReason(); got != tc.want {
+			t.Errorf("case %d: got(%v) != want(%v)", i, got, tc.want)
+		}
+	}
+}
+
+func TestHaltAddressError(t *testing.T) {
+	cases := []struct {
+		target  int32 // the word the JMP loads into ci
+		wantErr bool
+	}{
+		{-2, true},
+		{words - 1, true},
+		{1 << 20, true},
+		{-1, false}, // ci -1 fetches line 0 next
+		{3, false},
+	}
+
+	for i, tc := range cases {
+		var mem memory
+		mem[1] = (&instruction{op: JMP, data: 10}).toInt32()
+		mem[10] = tc.target
+		b := NewBaby(mem)
+		b.Step()
+		_, err := b.Step()
+
+		if tc.wantErr {
+			if err != badCI || b.running || b.HaltReason() != HaltAddressError || b.LastError() != badCI {
+				t.Errorf("case %d: err(%v), running(%t), HaltReason() = %v, LastError() = %v; want %v and stopped", i, err, b.running, b.HaltReason(), b.LastError(), badCI)
+			}
+		} else if err != nil || !b.running || b.LastError() != nil {
+			t.Errorf("case %d: err(%v), running(%t), LastError() = %v; want still running", i, err, b.running, b.LastError())
+		}
+
+		b.Reset()
+		if b.HaltReason() != HaltNone || b.LastError() != nil {
+			t.Errorf("case %d: after Reset HaltReason() = %v, LastError() = %v", i, b.HaltReason(), b.LastError())
+		}
+	}
+}
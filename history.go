@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultHistoryDepth = 64 // Steps remembered for StepBack by default
+)
+
+// traceFormat selects how each step is written to the trace.
+type traceFormat int
+
+const (
+	traceText traceFormat = iota // tab separated, as HistoryEntry.String
+	traceJSON                    // a JSON object per line, as traceRecord
+)
+
+var (
+	badTraceFormat = errors.New("invalid trace format - want text or json")
+	badTraceOp     = errors.New("invalid trace op - unknown instruction")
+	noHistory      = errors.New("invalid step back - no history available")
+	badTrace       = errors.New("invalid trace - want cycle, address, instruction and acc separated by tabs")
+	traceDiverged  = errors.New("invalid trace - replay diverged")
+)
+
+// HistoryEntry records the machine state immediately before a step was
+// executed so that the step can be undone, along with the instruction the
+// step executed. Only a STO changes the store, so rather than a copy of
+// the store an entry keeps the word a STO overwrote, which may be an
+// instruction in self-modifying code.
+type HistoryEntry struct {
+	Cycle   int64 // 1 for the first step after a reset
+	CI, ACC register
+	Inst    *instruction
+	running bool
+	stored  int32 // for a STO, the word it overwrote
+}
+
+// String formats the entry as a tab separated trace line: cycle, address
+// executed, instruction and the accumulator before execution.
+func (e HistoryEntry) String() string {
+	return fmt.Sprintf("%d\t%d\t%s\t%d", e.Cycle, e.CI+1, e.Inst, e.ACC)
+}
+
+// historyEntrySize is the memory SizePolicy counts for a history entry on
+// a 64-bit machine: 32 bytes for the entry (the cycle, the two registers,
+// the instruction pointer, running and the overwritten word, padded) and 8
+// for the instruction it points to.
+const historyEntrySize = 40
+
+// HistoryPolicy decides which history entries are kept for StepBack.
+type HistoryPolicy interface {
+	// Evict is given the history, oldest first, after each step is
+	// recorded and returns the entries to keep, also oldest first.
+	Evict(entries []HistoryEntry) []HistoryEntry
+}
+
+type depthPolicy int
+
+// DepthPolicy keeps the n most recent entries, as SetHistoryDepth does.
+func DepthPolicy(n int) HistoryPolicy {
+	return depthPolicy(n)
+}
+
+func (p depthPolicy) Evict(entries []HistoryEntry) []HistoryEntry {
+	return newest(entries, int(p))
+}
+
+type sizePolicy int
+
+// SizePolicy keeps as many of the most recent entries as fit in the given
+// number of bytes.
+func SizePolicy(bytes int) HistoryPolicy {
+	return sizePolicy(bytes)
+}
+
+func (p sizePolicy) Evict(entries []HistoryEntry) []HistoryEntry {
+	return newest(entries, int(p)/historyEntrySize)
+}
+
+// newest returns the last n of entries.
+func newest(entries []HistoryEntry, n int) []HistoryEntry {
+	if n < 0 {
+		n = 0
+	}
+	if len(entries) > n {
+		return entries[len(entries)-n:]
+	}
+
+	return entries
+}
+
+// SetHistoryDepth sets how many steps are remembered for StepBack,
+// replacing any policy set by SetHistoryPolicy. If the buffer already
+// holds more than n entries the oldest are discarded. A depth of 0
+// disables history entirely.
+func (b *baby) SetHistoryDepth(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	b.historyDepth = n
+	b.historyPolicy = nil
+	if len(b.history) > n {
+		b.history = append([]HistoryEntry(nil), b.history[len(b.history)-n:]...)
+	}
+}
+
+// SetMaxHistory remembers the n most recent steps for StepBack, like
+// SetHistoryDepth but installed as DepthPolicy(n), so the limit can later
+// be swapped for another policy with SetHistoryPolicy.
+func (b *baby) SetMaxHistory(n int) {
+	b.SetHistoryPolicy(DepthPolicy(n))
+}
+
+// SetHistoryPolicy makes p decide which steps are remembered for StepBack,
+// in place of the depth set by SetHistoryDepth. The current history is
+// trimmed by p straight away. A nil policy goes back to the depth.
+func (b *baby) SetHistoryPolicy(p HistoryPolicy) {
+	if p == nil {
+		b.SetHistoryDepth(b.historyDepth)
+		return
+	}
+
+	b.historyPolicy = p
+	b.history = append([]HistoryEntry(nil), p.Evict(b.history)...)
+}
+
+// traceRecord is a step as written to a JSON trace: the cycle, the
+// address executed, the instruction there and the accumulator before it
+// ran. CMP and STP have no operand.
+type traceRecord struct {
+	Step    int64  `json:"step"`
+	CI      int32  `json:"ci"`
+	Op      string `json:"op"`
+	Operand *int32 `json:"operand,omitempty"`
+	ACC     int32  `json:"acc"`
+}
+
+// record returns the trace record for e.
+func (e HistoryEntry) record() traceRecord {
+	r := traceRecord{Step: e.Cycle, CI: int32(e.CI + 1), Op: opNames[e.Inst.op], ACC: int32(e.ACC)}
+	switch e.Inst.op {
+	case CMP, STP:
+	default:
+		data := e.Inst.data
+		r.Operand = &data
+	}
+
+	return r
+}
+
+// parseTraceFormat returns the trace format named s.
+func parseTraceFormat(s string) (traceFormat, error) {
+	switch s {
+	case "text":
+		return traceText, nil
+	case "json":
+		return traceJSON, nil
+	default:
+		return traceText, badTraceFormat
+	}
+}
+
+// SetTraceFormat selects how steps are written to the trace writer.
+func (b *baby) SetTraceFormat(f traceFormat) {
+	b.traceFormat = f
+}
+
+// writeTrace writes e to the trace in the selected format.
+func (b *baby) writeTrace(e HistoryEntry) {
+	if b.traceFormat == traceJSON {
+		line, _ := json.Marshal(e.record())
+		fmt.Fprintf(b.trace, "%s\n", line)
+		return
+	}
+
+	fmt.Fprintln(b.trace, e)
+}
+
+// traceOpList is the opcodes named by repeated -trace-op flags.
+type traceOpList []int32
+
+func (l *traceOpList) String() string {
+	names := make([]string, len(*l))
+	for i, op := range *l {
+		names[i] = opNames[op]
+	}
+
+	return strings.Join(names, ",")
+}
+
+// Set adds the opcode with mnemonic s, in any case, to the list.
+func (l *traceOpList) Set(s string) error {
+	op, ok := nameOps[strings.ToUpper(s)]
+	if !ok {
+		return badTraceOp
+	}
+
+	*l = append(*l, op)
+	return nil
+}
+
+// SetTraceOps limits the trace to steps executing one of ops, leaving the
+// history untouched. With no ops every step is traced.
+func (b *baby) SetTraceOps(ops ...int32) {
+	b.traceOps = nil
+	for _, op := range ops {
+		if b.traceOps == nil {
+			b.traceOps = make(map[int32]bool)
+		}
+		b.traceOps[op] = true
+	}
+}
+
+// SetTraceWriter arranges for a trace line to be written to w for every
+// step executed. A nil writer turns tracing off.
+func (b *baby) SetTraceWriter(w io.Writer) {
+	b.trace = w
+}
+
+// record notes the current state, about to execute inst, in the history
+// buffer and trace. The oldest history entry is evicted once the buffer
+// is full, or as the history policy decides if there is one.
+func (b *baby) record(inst *instruction) {
+	e := HistoryEntry{Cycle: b.cycles, CI: b.ci, ACC: b.acc, Inst: inst, running: b.running}
+	if inst.op == STO {
+		e.stored = b.mem[inst.data]
+	}
+
+	if b.trace != nil && (b.traceOps == nil || b.traceOps[inst.op]) {
+		b.writeTrace(e)
+	}
+
+	if b.historyPolicy != nil {
+		b.history = b.historyPolicy.Evict(append(b.history, e))
+		return
+	}
+	if b.historyDepth == 0 {
+		return
+	}
+
+	if len(b.history) >= b.historyDepth {
+		b.history = b.history[len(b.history)-b.historyDepth+1:]
+	}
+	b.history = append(b.history, e)
+}
+
+// InstructionHistory returns up to the n most recent history entries,
+// oldest first.
+func (b *baby) InstructionHistory(n int) []HistoryEntry {
+	if n > len(b.history) {
+		n = len(b.history)
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	return append([]HistoryEntry(nil), b.history[len(b.history)-n:]...)
+}
+
+// DumpTrace writes every entry in the history buffer to w, oldest first,
+// in the same format used by SetTraceWriter.
+func (b *baby) DumpTrace(w io.Writer) error {
+	for _, e := range b.history {
+		if _, err := fmt.Fprintln(w, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StepBack undoes the most recent step, restoring the registers and store
+// to the state they were in before it executed. Changes made to the store
+// between steps, as by PokeMem, aren't steps and so are kept. Checkpoints
+// taken after the restored cycle are discarded.
+func (b *baby) StepBack() error {
+	if len(b.history) == 0 {
+		return noHistory
+	}
+
+	e := b.history[len(b.history)-1]
+	b.history = b.history[:len(b.history)-1]
+	b.ci, b.acc, b.running = e.CI, e.ACC, e.running
+	if e.Inst.op == STO {
+		b.mem[e.Inst.data] = e.stored
+	}
+	if b.running {
+		b.clearHalt()
+	}
+	b.cycles = e.Cycle - 1
+	b.beats -= opBeats[e.Inst.op]
+	b.addrCounts[e.CI+1]--
+	b.countAccess(e.Inst, -1)
+	b.last, b.lastInst = -1, nil
+	if len(b.history) > 0 {
+		prev := b.history[len(b.history)-1]
+		b.last, b.lastInst = int32(prev.CI+1), prev.Inst
+	}
+	for len(b.accLog) > 0 && b.accLog[len(b.accLog)-1].cycle > b.cycles {
+		b.accLog = b.accLog[:len(b.accLog)-1]
+	}
+	for len(b.checkpoints) > 0 && b.checkpoints[len(b.checkpoints)-1].cycle > b.cycles {
+		b.checkpoints = b.checkpoints[:len(b.checkpoints)-1]
+	}
+	if b.loops != nil {
+		b.loops.reset()
+	}
+
+	return nil
+}
+
+// Trace returns a preview of the next n steps, one line per step giving
+// the address executed, the instruction and the accumulator before and
+// after. The steps run on a copy of the machine, which is left untouched.
+// The preview ends early if the machine stops.
+func (b *baby) Trace(n int) string {
+	var sb strings.Builder
+
+	c := b.clone()
+	c.SetHistoryDepth(0)
+	for i := 0; i < n && c.running; i++ {
+		addr, before := c.ci+1, c.acc
+		inst, err := c.Step()
+		if err != nil {
+			fmt.Fprintf(&sb, "%04d: %v\n", addr, err)
+			break
+		}
+		fmt.Fprintf(&sb, "%04d: %-8s acc %d -> %d\n", addr, inst, before, c.acc)
+	}
+
+	return sb.String()
+}
+
+// ParseTrace reads a trace in the format written by DumpTrace and
+// SetTraceWriter back into history entries. Only the fields in the trace
+// are set; in particular the entries carry no store.
+func ParseTrace(r io.Reader) ([]HistoryEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading trace: %v", err)
+	}
+
+	var entries []HistoryEntry
+	for i, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		if len(f) != 4 {
+			return nil, fmt.Errorf("error on line %d: %v", i+1, badTrace)
+		}
+
+		cycle, cerr := strconv.ParseInt(f[0], 10, 64)
+		addr, aerr := parseDecimal(f[1])
+		_, inst, ierr := instructionFromCode("0 " + f[2])
+		acc, accErr := parseDecimal(f[3])
+		if cerr != nil || aerr != nil || ierr != nil || accErr != nil {
+			return nil, fmt.Errorf("error on line %d: %v", i+1, badTrace)
+		}
+		entries = append(entries, HistoryEntry{Cycle: cycle, CI: register(addr - 1), ACC: register(acc), Inst: inst, running: true})
+	}
+
+	return entries, nil
+}
+
+// ReplayTrace steps the machine once for each entry, checking first that
+// it is about to execute the recorded instruction from the recorded address
+// with the recorded accumulator. The machine should start in the state the
+// trace did, such as freshly loaded with the program that was traced. The
+// first entry that doesn't match is reported as a traceDiverged error.
+func (b *baby) ReplayTrace(entries []HistoryEntry) error {
+	for i, e := range entries {
+		got, want := "none", "none"
+		if next := b.ci + 1; next >= 0 && next < words {
+			got = instFromWord(b.mem[next]).String()
+		}
+		if e.Inst != nil {
+			want = e.Inst.String()
+		}
+		if b.ci != e.CI || b.acc != e.ACC || got != want {
+			return fmt.Errorf("%w at entry %d: want %d %s acc %d, got %d %s acc %d", traceDiverged, i, e.CI+1, want, e.ACC, b.ci+1, got, b.acc)
+		}
+
+		_, err := b.Step()
+		if errors.Is(err, breakpointHit) {
+			_, err = b.Step()
+		}
+		if err != nil && !errors.Is(err, watchpointHit) {
+			return fmt.Errorf("replaying entry %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
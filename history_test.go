@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loopMem returns a store holding a two instruction loop that decrements
+// the accumulator forever.
+func loopMem() memory {
+	var mem memory
+	mem[1] = (&instruction{op: SUB, data: 5}).toInt32()
+	mem[2] = (&instruction{op: JMP, data: 6}).toInt32()
+	mem[5] = 1
+	mem[6] = 0
+	return mem
+}
+
+func TestStepBack(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.SetHistoryDepth(3)
+
+	type state struct{ ci, acc register }
+	var states []state
+	for i := 0; i < 10; i++ {
+		states = append(states, state{b.ci, b.acc})
+		if _, err := b.Step(); err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := b.StepBack(); err != nil {
+			t.Fatalf("step back %d: unexpected error: %v", i, err)
+		}
+		want := states[len(states)-1-i]
+		if got := (state{b.ci, b.acc}); got != want {
+			t.Errorf("step back %d: got(%v) != want(%v)", i, got, want)
+		}
+	}
+
+	if err := b.StepBack(); err != noHistory {
+		t.Errorf("step back 3: err(%v) != wantErr(%v)", err, noHistory)
+	}
+}
+
+func TestSetHistoryDepth(t *testing.T) {
+	cases := []struct {
+		depth, steps, want int
+	}{
+		{3, 10, 3},
+		{64, 10, 10},
+		{0, 10, 0},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(loopMem())
+		for j := 0; j < tc.steps; j++ {
+			b.Step()
+		}
+		b.SetHistoryDepth(tc.depth)
+		if len(b.history) != tc.want {
+			t.Errorf("case %d: len(history) = %d, want %d", i, len(b.history), tc.want)
+		}
+		b.Step()
+		if tc.depth == 0 && len(b.history) != 0 {
+			t.Errorf("case %d: history recorded with depth 0", i)
+		}
+	}
+}
+
+func TestDumpTrace(t *testing.T) {
+	cases := []struct {
+		steps, depth, want int
+	}{
+		{10, defaultHistoryDepth, 10},
+		{100, defaultHistoryDepth, defaultHistoryDepth},
+		{10, 3, 3},
+		{10, 0, 0},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(loopMem())
+		b.SetHistoryDepth(tc.depth)
+		for j := 0; j < tc.steps; j++ {
+			b.Step()
+		}
+
+		var buf bytes.Buffer
+		if err := b.DumpTrace(&buf); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if got := strings.Count(buf.String(), "\n"); got != tc.want {
+			t.Errorf("case %d: got %d lines, want %d", i, got, tc.want)
+		}
+	}
+}
+
+func TestSetTraceWriter(t *testing.T) {
+	b := NewBaby(loopMem())
+	var buf bytes.Buffer
+	b.SetTraceWriter(&buf)
+	b.Step()
+	b.Step()
+	b.SetTraceWriter(nil)
+	b.Step()
+
+	want := "1\t1\tSUB 5\t0\n2\t2\tJMP 6\t-1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	var dump bytes.Buffer
+	b.DumpTrace(&dump)
+	if !strings.HasPrefix(dump.String(), want) {
+		t.Errorf("DumpTrace = %q, want prefix %q", dump.String(), want)
+	}
+}
+
+func TestTraceFormatJSON(t *testing.T) {
+	var mem memory
+	mem[1] = (&instruction{op: LDN, data: 20}).toInt32()
+	mem[2] = (&instruction{op: CMP}).toInt32()
+	mem[3] = (&instruction{op: STO, data: 21}).toInt32()
+	mem[4] = (&instruction{op: STP}).toInt32()
+	mem[20] = 7
+	b := NewBaby(mem)
+
+	var buf bytes.Buffer
+	b.SetTraceWriter(&buf)
+	b.SetTraceFormat(traceJSON)
+	b.StepN(10)
+
+	want := `{"step":1,"ci":1,"op":"LDN","operand":20,"acc":0}
+{"step":2,"ci":2,"op":"CMP","acc":-7}
+{"step":3,"ci":4,"op":"STP","acc":-7}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	cases := []struct {
+		name    string
+		want    traceFormat
+		wantErr error
+	}{
+		{"text", traceText, nil},
+		{"json", traceJSON, nil},
+		{"JSON", traceText, badTraceFormat},
+		{"", traceText, badTraceFormat},
+	}
+	for i, tc := range cases {
+		if got, err := parseTraceFormat(tc.name); got != tc.want || err != tc.wantErr {
+			t.Errorf("case %d: got(%v, %v) != want(%v, %v)", i, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestStepBackSelfModifying(t *testing.T) {
+	// The program overwrites the instruction at line 0 and then its own
+	// next instruction, which it goes on to execute.
+	var mem memory
+	mem[0] = (&instruction{op: SUB, data: 9}).toInt32()
+	mem[1] = (&instruction{op: LDN, data: 20}).toInt32()
+	mem[2] = (&instruction{op: STO, data: 0}).toInt32()
+	mem[3] = (&instruction{op: LDN, data: 21}).toInt32()
+	mem[4] = (&instruction{op: STO, data: 5}).toInt32()
+	mem[5] = (&instruction{op: CMP}).toInt32()
+	mem[6] = (&instruction{op: STP}).toInt32()
+	mem[20] = -42
+	mem[21] = -(&instruction{op: LDN, data: 20}).toInt32()
+	orig := mem
+
+	b := NewBaby(mem)
+	var states []memory
+	for b.running {
+		states = append(states, b.mem)
+		if _, err := b.Step(); err != nil {
+			t.Fatalf("step: unexpected error: %v", err)
+		}
+	}
+	if b.mem[0] != 42 || b.mem[5] == orig[5] {
+		t.Fatalf("program didn't modify itself: mem[0] = %d, mem[5] = %d", b.mem[0], b.mem[5])
+	}
+
+	for i := len(states) - 1; i >= 0; i-- {
+		if err := b.StepBack(); err != nil {
+			t.Fatalf("StepBack to step %d: unexpected error: %v", i, err)
+		}
+		if b.mem != states[i] {
+			t.Errorf("after StepBack to step %d store is %v, want %v", i, b.mem, states[i])
+		}
+	}
+	if b.mem[0] != orig[0] {
+		t.Errorf("mem[0] = %d, want %d", b.mem[0], orig[0])
+	}
+
+	// Pokes between steps aren't undone.
+	b.Step()
+	b.PokeMem(30, 7)
+	b.StepBack()
+	if b.mem[30] != 7 {
+		t.Errorf("StepBack undid a poke: mem[30] = %d", b.mem[30])
+	}
+}
+
+func TestTraceOps(t *testing.T) {
+	var ops traceOpList
+	for _, name := range []string{"SUB", "cmp"} {
+		if err := ops.Set(name); err != nil {
+			t.Fatalf("Set(%q): unexpected error: %v", name, err)
+		}
+	}
+	if err := ops.Set("NUM"); err != badTraceOp {
+		t.Errorf("Set(\"NUM\") = %v, want %v", err, badTraceOp)
+	}
+	if got := ops.String(); got != "SUB,CMP" {
+		t.Errorf("String() = %q, want \"SUB,CMP\"", got)
+	}
+
+	cases := []struct {
+		ops  []int32
+		want []string // opcodes traced, in order
+	}{
+		{nil, []string{"LDN", "SUB", "CMP", "SUB", "CMP", "STP"}},
+		{ops, []string{"SUB", "CMP", "SUB", "CMP"}},
+		{[]int32{STP}, []string{"STP"}},
+		{[]int32{JMP}, nil},
+	}
+
+	for i, tc := range cases {
+		var mem memory
+		mem[1] = (&instruction{op: LDN, data: 20}).toInt32()
+		mem[2] = (&instruction{op: SUB, data: 21}).toInt32()
+		mem[3] = (&instruction{op: CMP}).toInt32()
+		mem[4] = (&instruction{op: SUB, data: 21}).toInt32()
+		mem[5] = (&instruction{op: CMP}).toInt32()
+		mem[6] = (&instruction{op: STP}).toInt32()
+		b := NewBaby(mem)
+
+		var buf bytes.Buffer
+		b.SetTraceWriter(&buf)
+		b.SetTraceFormat(traceJSON)
+		b.SetTraceOps(tc.ops...)
+		b.StepN(10)
+
+		var got []string
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var r traceRecord
+			if err := dec.Decode(&r); err != nil {
+				t.Fatalf("case %d: bad trace: %v", i, err)
+			}
+			got = append(got, r.Op)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("case %d: got(%v) != want(%v)", i, got, tc.want)
+		}
+		// The history has every step whatever is traced.
+		if n := len(b.InstructionHistory(10)); n != 6 {
+			t.Errorf("case %d: %d history entries, want 6", i, n)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.Step()
+	ci, acc, cycles := b.ci, b.acc, b.cycles
+
+	want := "0002: JMP 6    acc -1 -> -1\n" +
+		"0001: SUB 5    acc -1 -> -2\n" +
+		"0002: JMP 6    acc -2 -> -2\n" +
+		"0001: SUB 5    acc -2 -> -3\n" +
+		"0002: JMP 6    acc -3 -> -3\n"
+	if got := b.Trace(5); got != want {
+		t.Errorf("Trace(5) = %q, want %q", got, want)
+	}
+	if b.ci != ci || b.acc != acc || b.cycles != cycles || len(b.history) != 1 {
+		t.Errorf("Trace modified the machine: ci %d, acc %d, cycles %d, history %d", b.ci, b.acc, b.cycles, len(b.history))
+	}
+}
+
+func TestTraceStops(t *testing.T) {
+	var mem memory
+	mem[1] = (&instruction{op: STP}).toInt32()
+	b := NewBaby(mem)
+	if got, want := b.Trace(5), "0001: STP      acc 0 -> 0\n"; got != want {
+		t.Errorf("Trace(5) = %q, want %q", got, want)
+	}
+
+	b = NewBaby(loopMem())
+	b.SetMaxSteps(2)
+	want := "0001: SUB 5    acc 0 -> -1\n" +
+		"0002: JMP 6    acc -1 -> -1\n" +
+		"0001: " + tooManySteps.Error() + "\n"
+	if got := b.Trace(5); got != want {
+		t.Errorf("Trace(5) = %q, want %q", got, want)
+	}
+}
+
+func TestReplayTrace(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+
+	b := NewBaby(mem)
+	b.SetHistoryDepth(1000)
+	for b.running {
+		b.Step()
+	}
+	var trace bytes.Buffer
+	if err := b.DumpTrace(&trace); err != nil {
+		t.Fatalf("DumpTrace: unexpected error: %v", err)
+	}
+
+	entries, err := ParseTrace(&trace)
+	if err != nil {
+		t.Fatalf("ParseTrace: unexpected error: %v", err)
+	}
+	if len(entries) != int(b.cycles) {
+		t.Fatalf("parsed %d entries, want %d", len(entries), b.cycles)
+	}
+
+	r := NewBaby(mem)
+	if err := r.ReplayTrace(entries); err != nil {
+		t.Errorf("ReplayTrace(parsed) = %v", err)
+	}
+	if r.mem != b.mem || r.ci != b.ci || r.acc != b.acc || r.running {
+		t.Errorf("replay finished in a different state")
+	}
+
+	// The history entries replay just as well as the parsed trace.
+	if err := NewBaby(mem).ReplayTrace(b.InstructionHistory(1000)); err != nil {
+		t.Errorf("ReplayTrace(history) = %v", err)
+	}
+
+	entries[3].ACC++
+	err = NewBaby(mem).ReplayTrace(entries)
+	if !errors.Is(err, traceDiverged) || !strings.Contains(err.Error(), "at entry 3:") {
+		t.Errorf("ReplayTrace(altered) = %v, want %v at entry 3", err, traceDiverged)
+	}
+}
+
+func TestParseTraceErrors(t *testing.T) {
+	for i, input := range []string{"1\t2\tSUB 5\n", "x\t2\tSUB 5\t0\n", "1\t2\tBAD 5\t0\n", "1\t2\tSUB 5\tacc\n"} {
+		if _, err := ParseTrace(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), badTrace.Error()) {
+			t.Errorf("case %d: ParseTrace(%q) = %v, want %v", i, input, err, badTrace)
+		}
+	}
+}
+
+// evenCycles is a history policy that keeps only even cycles.
+type evenCycles struct{}
+
+func (evenCycles) Evict(entries []HistoryEntry) []HistoryEntry {
+	var kept []HistoryEntry
+	for _, e := range entries {
+		if e.Cycle%2 == 0 {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+func TestHistoryPolicy(t *testing.T) {
+	cases := []struct {
+		policy     HistoryPolicy
+		wantCycles []int64
+	}{
+		{DepthPolicy(2), []int64{9, 10}},
+		{DepthPolicy(0), nil},
+		{SizePolicy(3 * historyEntrySize), []int64{8, 9, 10}},
+		{SizePolicy(3*historyEntrySize + historyEntrySize - 1), []int64{8, 9, 10}},
+		{SizePolicy(historyEntrySize - 1), nil},
+		{evenCycles{}, []int64{2, 4, 6, 8, 10}},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(loopMem())
+		b.SetHistoryPolicy(tc.policy)
+		b.StepN(10)
+
+		var got []int64
+		for _, e := range b.InstructionHistory(words) {
+			got = append(got, e.Cycle)
+		}
+		if !reflect.DeepEqual(got, tc.wantCycles) {
+			t.Errorf("case %d: got(%v) != want(%v)", i, got, tc.wantCycles)
+		}
+	}
+
+	// Installing a policy trims the history already kept, and setting a
+	// depth replaces the policy.
+	b := NewBaby(loopMem())
+	b.StepN(10)
+	b.SetHistoryPolicy(SizePolicy(2 * historyEntrySize))
+	if n := len(b.history); n != 2 {
+		t.Errorf("SetHistoryPolicy kept %d entries, want 2", n)
+	}
+	b.SetHistoryDepth(5)
+	b.StepN(10)
+	if n := len(b.history); n != 5 || b.historyPolicy != nil {
+		t.Errorf("after SetHistoryDepth(5): %d entries, policy %v", n, b.historyPolicy)
+	}
+	b.SetMaxHistory(3)
+	b.StepN(10)
+	if n := len(b.history); n != 3 || b.historyPolicy != DepthPolicy(3) {
+		t.Errorf("after SetMaxHistory(3): %d entries, policy %v", n, b.historyPolicy)
+	}
+	b.SetHistoryPolicy(DepthPolicy(1))
+	b.SetHistoryPolicy(nil)
+	b.StepN(10)
+	if n := len(b.history); n != 5 {
+		t.Errorf("after SetHistoryPolicy(nil): %d entries, want the depth of 5", n)
+	}
+}
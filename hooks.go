@@ -0,0 +1,77 @@
+package main
+
+// StepHook is called after each instruction executes.
+type StepHook func(inst *instruction)
+
+// MemWriteHook is called when a word in the store changes, by a STO or a
+// poke, with the word's old and new values.
+type MemWriteHook func(addr, old, new int32)
+
+// BreakHook is called when a break condition pauses execution.
+type BreakHook func(b *baby)
+
+// OnStep sets the hook called after each step. A nil fn removes it.
+func (b *baby) OnStep(fn StepHook) {
+	b.stepHook = fn
+}
+
+// OnMemWrite sets the hook called for each write to the store. A nil fn
+// removes it.
+func (b *baby) OnMemWrite(fn MemWriteHook) {
+	b.memWriteHook = fn
+}
+
+// OnBreak sets the hook called when a break condition pauses execution. A
+// nil fn removes it. The hook may call Resume to carry straight on.
+func (b *baby) OnBreak(fn BreakHook) {
+	b.breakHook = fn
+}
+
+// DisableHooks stops the step, store write and break hooks being called,
+// for instance while making many changes with Merge. The OnHalt hook still
+// runs.
+func (b *baby) DisableHooks() {
+	b.hooksEnabled = false
+}
+
+// EnableHooks undoes DisableHooks.
+func (b *baby) EnableHooks() {
+	b.hooksEnabled = true
+}
+
+// stepped calls the step hook for inst, if hooks are enabled.
+func (b *baby) stepped(inst *instruction) {
+	if b.hooksEnabled && b.stepHook != nil {
+		b.stepHook(inst)
+	}
+}
+
+// broke calls the break hook, if hooks are enabled.
+func (b *baby) broke() {
+	if b.hooksEnabled && b.breakHook != nil {
+		b.breakHook(b)
+	}
+}
+
+// memWritten calls the store write hook, if hooks are enabled.
+func (b *baby) memWritten(addr, old, new int32) {
+	if b.hooksEnabled && b.memWriteHook != nil {
+		b.memWriteHook(addr, old, new)
+	}
+}
+
+// Merge pokes each of the words given, keyed by address, into the store.
+// Nothing is changed if any address is outside the store.
+func (b *baby) Merge(ws map[int32]int32) error {
+	for addr := range ws {
+		if addr < 0 || addr >= words {
+			return badAddress
+		}
+	}
+
+	for _, addr := range sortedAddrs(ws) {
+		b.PokeMem(addr, ws[addr])
+	}
+
+	return nil
+}
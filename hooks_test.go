@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	var (
+		steps  int
+		writes []int32
+		halts  int
+	)
+	b := NewWithConfig(BabyConfig{
+		Memory:     loopMem(),
+		OnStep:     func(*instruction) { steps++ },
+		OnMemWrite: func(addr, old, new int32) { writes = append(writes, addr) },
+		OnHalt:     func() { halts++ },
+	})
+
+	b.DisableHooks()
+	b.StepN(5)
+	b.PokeMem(7, 1)
+	if err := b.Merge(map[int32]int32{9: 1, 8: 2}); err != nil {
+		t.Fatalf("Merge() = %v", err)
+	}
+	if steps != 0 || len(writes) != 0 {
+		t.Errorf("disabled hooks called: steps(%d), writes(%v)", steps, writes)
+	}
+	if b.mem[7] != 1 || b.mem[8] != 2 || b.mem[9] != 1 {
+		t.Errorf("pokes and Merge didn't change the store")
+	}
+
+	// OnHalt isn't affected by DisableHooks.
+	b.running = false
+	b.ConnectTerminal(strings.NewReader(""), &strings.Builder{})
+	b.Run()
+	if halts != 1 {
+		t.Errorf("OnHalt called %d times with hooks disabled, want 1", halts)
+	}
+
+	b.EnableHooks()
+	b.running = true
+	b.StepN(5)
+	if err := b.Merge(map[int32]int32{9: 3, 8: 4}); err != nil {
+		t.Fatalf("Merge() = %v", err)
+	}
+	if steps != 5 || !reflect.DeepEqual(writes, []int32{8, 9}) {
+		t.Errorf("enabled hooks: steps(%d) != 5 || writes(%v) != [8 9]", steps, writes)
+	}
+}
+
+func TestMemWriteHookSTO(t *testing.T) {
+	b := NewBaby(breakMem())
+	var got [][3]int32
+	b.OnMemWrite(func(addr, old, new int32) { got = append(got, [3]int32{addr, old, new}) })
+
+	b.StepN(10)
+	if want := [][3]int32{{22, 0, -9}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("writes = %v, want %v", got, want)
+	}
+}
+
+func TestMergeBadAddress(t *testing.T) {
+	b := NewBaby(loopMem())
+	if err := b.Merge(map[int32]int32{3: 1, 32: 1}); err != badAddress {
+		t.Errorf("Merge() = %v, want %v", err, badAddress)
+	}
+	if b.mem != loopMem() {
+		t.Errorf("failed Merge changed the store")
+	}
+}
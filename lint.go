@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var lintFailed = errors.New("invalid program - lint found problems")
+
+// Lint checks, named as diagnostics report them.
+const (
+	checkOverwrite = "overwrite" // an entry replaces an earlier one
+	checkOperand   = "operand"   // an operand is outside the store
+)
+
+// diagnostic is a problem the linter found on a source line.
+type diagnostic struct {
+	line  int
+	addr  int32  // store line the entry was placed on
+	check string // the check that found it
+	msg   string
+}
+
+// lint looks for mistakes in an assembled program that the assembler
+// accepts: entries that overwrite an earlier one and instruction operands
+// outside the store. Programs without a STP are fine; several of the
+// samples run forever. Diagnostics are sorted by store line, then check,
+// then source line, so the output is the same however the checks run.
+func (p *program) lint() []diagnostic {
+	var (
+		diags []diagnostic
+		setBy = make(map[int32]int)
+	)
+
+	for _, sl := range p.lines {
+		if prev, ok := setBy[sl.addr]; ok {
+			diags = append(diags, diagnostic{sl.line, sl.addr, checkOverwrite, fmt.Sprintf("overwrites store line %d, set on line %d", sl.addr, prev)})
+		}
+		setBy[sl.addr] = sl.line
+
+		if sl.inst == nil {
+			continue
+		}
+		if op := sl.inst.op; op != CMP && op != STP && (sl.inst.data < 0 || sl.inst.data >= words) {
+			diags = append(diags, diagnostic{sl.line, sl.addr, checkOperand, fmt.Sprintf("operand %d is outside the store", sl.inst.data)})
+		}
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.addr != b.addr {
+			return a.addr < b.addr
+		}
+		if a.check != b.check {
+			return a.check < b.check
+		}
+		return a.line < b.line
+	})
+
+	return diags
+}
+
+// checkProgram assembles and lints the inline program src, or the one in
+// path if src is empty, without running it, writing any problems to w as
+// "name:line: message", where name is path or "-program". It returns an
+// error wrapping loadFailed if the program doesn't assemble, or lintFailed
+// if the linter found anything.
+func checkProgram(asm assembler, src, path string, w io.Writer) error {
+	name := sourceName(src, path)
+	p, err := asm.assembleSource(src, path)
+	if err != nil {
+		fmt.Fprintf(w, "%s: %v\n", name, err)
+		return fmt.Errorf("%w: %v", loadFailed, err)
+	}
+
+	diags := p.lint()
+	for _, d := range diags {
+		fmt.Fprintf(w, "%s:%d: %s\n", name, d.line, d.msg)
+	}
+	if len(diags) > 0 {
+		return lintFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	cases := []struct {
+		src  string
+		want []diagnostic
+	}{
+		{"0001 LDN 5\n0002 STP\n0005 NUM 3\n", nil},
+		{"0001 LDN 5\n0001 SUB 5\n0002 STP\n", []diagnostic{{2, 1, checkOverwrite, "overwrites store line 1, set on line 1"}}},
+		{"0001 LDN 31\n0002 SUB 32\n0003 STP\n", []diagnostic{{2, 2, checkOperand, "operand 32 is outside the store"}}},
+		{"0001 LDN 5\n0005 NUM 3\n", nil}, // Running forever is allowed.
+		{"0001 CMP\n0002 STP\n", nil},
+	}
+
+	for i, tc := range cases {
+		p, err := assemble(strings.NewReader(tc.src))
+		if err != nil {
+			t.Fatalf("case %d: assemble: unexpected error: %v", i, err)
+		}
+		if got := p.lint(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("case %d: got(%v) != want(%v)", i, got, tc.want)
+		}
+	}
+}
+
+func TestLintOrder(t *testing.T) {
+	// Later lines set earlier store lines, and line 2 is both overwritten
+	// and given an operand outside the store.
+	src := "0005 LDN 40\n0002 SUB 33\n0005 STP\n0002 STO 32\n0001 NUM 1\n0001 NUM 2\n"
+	p, err := assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("assemble: unexpected error: %v", err)
+	}
+
+	want := []diagnostic{
+		{6, 1, checkOverwrite, "overwrites store line 1, set on line 5"},
+		{2, 2, checkOperand, "operand 33 is outside the store"},
+		{4, 2, checkOperand, "operand 32 is outside the store"},
+		{4, 2, checkOverwrite, "overwrites store line 2, set on line 2"},
+		{1, 5, checkOperand, "operand 40 is outside the store"},
+		{3, 5, checkOverwrite, "overwrites store line 5, set on line 1"},
+	}
+	if got := p.lint(); !reflect.DeepEqual(got, want) {
+		t.Errorf("lint() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckProgram(t *testing.T) {
+	good := writeProgram(t, "0001 LDN 5\n0002 STP\n0005 NUM 3\n")
+	overwrite := writeProgram(t, "0001 LDN 5\n0001 STP\n")
+	bad := writeProgram(t, "0001 LDN\n")
+
+	cases := []struct {
+		src, path string
+		wantErr   error
+		wantCode  int
+		wantOut   string
+	}{
+		{"", good, nil, exitOK, ""},
+		{"", "primes.baby", nil, exitOK, ""},
+		{"", overwrite, lintFailed, exitError, overwrite + ":2: overwrites store line 1, set on line 1\n"},
+		{"", bad, loadFailed, exitLoad, bad + ": error on line 1: " + missingOp.Error() + "\n"},
+		// An inline program is checked in place of the file.
+		{"0001 LDN 5;0002 STP", bad, nil, exitOK, ""},
+		{"0001 LDN 5;0001 STP", good, lintFailed, exitError, "-program:2: overwrites store line 1, set on line 1\n"},
+		{"0001 LDN", good, loadFailed, exitLoad, "-program: error on line 1: " + missingOp.Error() + "\n"},
+	}
+
+	for i, tc := range cases {
+		var out strings.Builder
+		err := checkProgram(assembler{}, tc.src, tc.path, &out)
+		if !errors.Is(err, tc.wantErr) || exitCode(err) != tc.wantCode {
+			t.Errorf("case %d: err(%v), exit code %d != want %v, %d", i, err, exitCode(err), tc.wantErr, tc.wantCode)
+		}
+		if out.String() != tc.wantOut {
+			t.Errorf("case %d: output %q != want %q", i, out.String(), tc.wantOut)
+		}
+	}
+}
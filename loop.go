@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+const (
+	loopSampleInterval = 16   // Steps between recorded state samples
+	loopMaxSamples     = 4096 // Samples kept before the detector starts afresh
+)
+
+var (
+	livelock = errors.New("invalid program - machine state repeated, execution will never halt")
+)
+
+// loopDetector spots a machine that has returned to a state it was in
+// before. Because the Baby is deterministic, any repeated state means the
+// program can never halt. Only every loopSampleInterval'th state is
+// remembered, but every state is checked, so a cycle is caught within one
+// pass of the cycle plus one sample interval.
+type loopDetector struct {
+	seen  map[uint64]bool
+	steps int
+}
+
+func newLoopDetector() *loopDetector {
+	return &loopDetector{seen: make(map[uint64]bool)}
+}
+
+// observe reports whether the state hash h has been sampled before.
+func (d *loopDetector) observe(h uint64) bool {
+	if d.seen[h] {
+		return true
+	}
+
+	d.steps++
+	if d.steps%loopSampleInterval == 0 {
+		if len(d.seen) >= loopMaxSamples {
+			d.seen = make(map[uint64]bool)
+		}
+		d.seen[h] = true
+	}
+
+	return false
+}
+
+func (d *loopDetector) reset() {
+	d.seen = make(map[uint64]bool)
+	d.steps = 0
+}
+
+// stateHash returns a hash of the registers and the entire store.
+func (b *baby) stateHash() uint64 {
+	var buf [4 * (words + 2)]byte
+
+	binary.LittleEndian.PutUint32(buf[0:], uint32(b.ci))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(b.acc))
+	for i, w := range b.mem {
+		binary.LittleEndian.PutUint32(buf[8+4*i:], uint32(w))
+	}
+
+	h := fnv.New64a()
+	h.Write(buf[:])
+	return h.Sum64()
+}
+
+// SetLoopDetection enables or disables stopping the machine when it
+// repeats a previous state.
+func (b *baby) SetLoopDetection(on bool) {
+	if on {
+		b.loops = newLoopDetector()
+	} else {
+		b.loops = nil
+	}
+}
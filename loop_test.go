@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestLoopDetection(t *testing.T) {
+	// 0001 JMP 5, with line 5 holding 0, spins on line 1 forever.
+	var spin memory
+	spin[1] = (&instruction{op: JMP, data: 5}).toInt32()
+
+	// 0001 STP halts straight away.
+	var halt memory
+	halt[1] = (&instruction{op: STP}).toInt32()
+
+	cases := []struct {
+		mem     memory
+		wantErr error
+	}{
+		{spin, livelock},
+		{halt, nil},
+		{loopMem(), nil}, // The accumulator changes every pass.
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(tc.mem)
+		b.SetLoopDetection(true)
+
+		var err error
+		for n := 0; n < 2*loopSampleInterval+1 && b.running && err == nil; n++ {
+			_, err = b.Step()
+		}
+		if err != tc.wantErr {
+			t.Errorf("case %d: err(%v) != wantErr(%v)", i, err, tc.wantErr)
+		}
+		if tc.wantErr != nil && b.running {
+			t.Errorf("case %d: machine still running after loop detected", i)
+		}
+	}
+}
+
+func TestLoopDetectorReset(t *testing.T) {
+	var spin memory
+	spin[1] = (&instruction{op: JMP, data: 5}).toInt32()
+	b := NewBaby(spin)
+	b.SetLoopDetection(true)
+
+	for n := 0; n < loopSampleInterval; n++ {
+		b.Step()
+	}
+	b.Reset()
+	if _, err := b.Step(); err != nil {
+		t.Errorf("err(%v) != nil after Reset", err)
+	}
+}
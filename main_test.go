@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary stand in for the baby binary: when
+// BABY_TEST_MAIN is set it runs main with the supplied arguments. When
+// BABY_TEST_EDIT is set it stands in for an editor instead, as fakeEditor.
+func TestMain(m *testing.M) {
+	if os.Getenv("BABY_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	if edit := os.Getenv("BABY_TEST_EDIT"); edit != "" {
+		os.Exit(fakeEditor(edit, os.Args[len(os.Args)-1]))
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the baby binary with args, feeding it stdin, and returns
+// its combined output.
+func runMain(t *testing.T, stdin string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "BABY_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running %v: %v\n%s", args, err, out)
+	}
+
+	return string(out)
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %q: %v", path, err)
+	}
+
+	return data
+}
+
+func TestStateFlagAliases(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output")
+	saveState := filepath.Join(dir, "save-state")
+
+	runMain(t, "S\nS\nQ\n", "-programfile", "test.baby", "-output", output)
+	runMain(t, "S\nS\nQ\n", "-programfile", "test.baby", "-save-state", saveState)
+	if a, b := readFile(t, output), readFile(t, saveState); !bytes.Equal(a, b) || len(a) == 0 {
+		t.Fatalf("-output wrote %q, -save-state wrote %q", a, b)
+	}
+
+	restored := filepath.Join(dir, "restored")
+	loaded := filepath.Join(dir, "loaded")
+	runMain(t, "S\nQ\n", "-restore", output, "-output", restored)
+	runMain(t, "S\nQ\n", "-load-state", output, "-output", loaded)
+	if a, b := readFile(t, restored), readFile(t, loaded); !bytes.Equal(a, b) || len(a) == 0 {
+		t.Errorf("-restore wrote %q, -load-state wrote %q", a, b)
+	}
+}
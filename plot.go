@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// accSample is the state of the accumulator after one step.
+type accSample struct {
+	cycle   int64
+	acc, ci register
+}
+
+// RecordAccumulator turns on or off recording of the accumulator after
+// every step, for export with WritePlot. Turning it off discards anything
+// recorded.
+func (b *baby) RecordAccumulator(on bool) {
+	b.recordACC = on
+	b.accLog = nil
+}
+
+// WritePlot writes the recorded accumulator values to w as CSV with the
+// columns step, acc and ci.
+func (b *baby) WritePlot(w io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("step,acc,ci\n")
+	for _, s := range b.accLog {
+		fmt.Fprintf(&sb, "%d,%d,%d\n", s.cycle, s.acc, s.ci)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writePlotFile writes the recorded accumulator values to the file at path.
+func writePlotFile(b *baby, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := b.WritePlot(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
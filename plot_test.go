@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestWritePlot(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.Step()
+	b.RecordAccumulator(true)
+	for i := 0; i < 4; i++ {
+		b.Step()
+	}
+
+	var buf bytes.Buffer
+	if err := b.WritePlot(&buf); err != nil {
+		t.Fatalf("WritePlot: unexpected error: %v", err)
+	}
+	want := "step,acc,ci\n2,-1,0\n3,-2,1\n4,-2,0\n5,-3,1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WritePlot wrote %q, want %q", got, want)
+	}
+
+	b.StepBack()
+	buf.Reset()
+	b.WritePlot(&buf)
+	if got, want := buf.String(), "step,acc,ci\n2,-1,0\n3,-2,1\n4,-2,0\n"; got != want {
+		t.Errorf("after StepBack WritePlot wrote %q, want %q", got, want)
+	}
+}
+
+func TestRunBatchPlot(t *testing.T) {
+	plot := filepath.Join(t.TempDir(), "plot.csv")
+	prog := writeProgram(t, "0001 LDN 5\n0002 SUB 5\n0003 STP\n0005 NUM 3\n")
+	if err := runBatch(batchOptions{programfile: prog, plot: plot}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("runBatch: unexpected error: %v", err)
+	}
+
+	if got, want := string(readFile(t, plot)), "step,acc,ci\n1,-3,1\n2,-6,2\n3,-6,3\n"; got != want {
+		t.Errorf("plot file = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build debug
+
+package main
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// raceOwner records the goroutine that first stepped a machine, 0 until
+// one has, and whether any other goroutine has since. The fields are
+// only used atomically, since the point is to notice goroutines sharing
+// the machine without locking. They are 32 bits so that is possible
+// wherever the machine sits in memory on 32-bit platforms; the low bits of
+// a goroutine ID are plenty to tell the goroutines using it apart.
+type raceOwner struct {
+	goroutine uint32
+	shared    uint32
+}
+
+// goroutineID returns the current goroutine's ID, as shown at the start of
+// its stack trace: "goroutine 7 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	s := string(buf[:runtime.Stack(buf[:], false)])
+	id, _ := strconv.ParseUint(strings.Fields(strings.TrimPrefix(s, "goroutine "))[0], 10, 64)
+	return id
+}
+
+// noteAccess records that the current goroutine is using the machine.
+func (b *baby) noteAccess() {
+	id := uint32(goroutineID())
+	if !atomic.CompareAndSwapUint32(&b.owner.goroutine, 0, id) && atomic.LoadUint32(&b.owner.goroutine) != id {
+		atomic.StoreUint32(&b.owner.shared, 1)
+	}
+}
+
+// releaseAccess hands the machine on, so the next goroutine to use it
+// becomes its owner.
+func (b *baby) releaseAccess() {
+	if atomic.LoadUint32(&b.owner.shared) == 0 {
+		atomic.StoreUint32(&b.owner.goroutine, 0)
+	}
+}
+
+// RaceCheck returns concurrentAccess if more than one goroutine has
+// stepped the machine without handing it over, as RunAsync does when its
+// run ends. This build, with the debug tag, does the checking.
+func (b *baby) RaceCheck() error {
+	if atomic.LoadUint32(&b.owner.shared) != 0 {
+		return concurrentAccess
+	}
+
+	return nil
+}
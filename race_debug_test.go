@@ -0,0 +1,55 @@
+//go:build debug
+
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRaceCheck(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.Step()
+	b.Step()
+	if err := b.RaceCheck(); err != nil {
+		t.Errorf("RaceCheck() after steps from one goroutine = %v, want nil", err)
+	}
+
+	// Two goroutines take turns stepping, so the test itself is free of
+	// races, but neither hands over to the other.
+	b = NewBaby(loopMem())
+	turns := []chan bool{make(chan bool), make(chan bool)}
+	done := make(chan bool)
+	for _, turn := range turns {
+		go func(turn chan bool) {
+			for range turn {
+				b.Step()
+				done <- true
+			}
+		}(turn)
+	}
+	for i := 0; i < 10; i++ {
+		turns[i%2] <- true
+		<-done
+	}
+	for _, turn := range turns {
+		close(turn)
+	}
+	if err := b.RaceCheck(); err != concurrentAccess {
+		t.Errorf("RaceCheck() after steps from two goroutines = %v, want %v", err, concurrentAccess)
+	}
+}
+
+func TestRaceCheckRunAsync(t *testing.T) {
+	b := NewBaby(breakMem())
+	b.RunAsync()
+	if err := b.WaitForHalt(context.Background()); err != nil {
+		t.Fatalf("WaitForHalt() = %v", err)
+	}
+
+	b.Reset()
+	b.Step()
+	if err := b.RaceCheck(); err != nil {
+		t.Errorf("RaceCheck() after a finished RunAsync = %v, want nil", err)
+	}
+}
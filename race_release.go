@@ -0,0 +1,17 @@
+//go:build !debug
+
+package main
+
+// raceOwner holds nothing outside debug builds, so they pay nothing for
+// the race check.
+type raceOwner struct{}
+
+func (b *baby) noteAccess()    {}
+func (b *baby) releaseAccess() {}
+
+// RaceCheck returns concurrentAccess if more than one goroutine has
+// used the machine at once. Checking costs a stack trace per step, so it
+// is only done in builds with the debug tag; this one always returns nil.
+func (b *baby) RaceCheck() error {
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxCommands = 500 // Commands kept in the REPL's history
+
+	// The control keys editLine acts on.
+	ctrlC     = 0x03
+	ctrlD     = 0x04
+	backspace = 0x08
+	escape    = 0x1b
+	del       = 0x7f
+)
+
+var noCommand = errors.New("invalid recall - no such command in the history")
+
+// commandHistory holds the commands entered at the REPL, oldest first.
+type commandHistory struct {
+	entries []string
+}
+
+// add appends cmd to the history, unless it's empty or repeats the most
+// recent entry.
+func (h *commandHistory) add(cmd string) {
+	if cmd == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == cmd) {
+		return
+	}
+
+	h.entries = append(h.entries, cmd)
+	if len(h.entries) > maxCommands {
+		h.entries = h.entries[len(h.entries)-maxCommands:]
+	}
+}
+
+// recall returns the nth most recent command, where 1 is the last one.
+func (h *commandHistory) recall(n int) (string, error) {
+	if n < 1 || n > len(h.entries) {
+		return "", noCommand
+	}
+
+	return h.entries[len(h.entries)-n], nil
+}
+
+// expand returns the command line should run: the last command for "!!",
+// command n of the listing for "!n", and line itself otherwise. It reports
+// whether the command was recalled.
+func (h *commandHistory) expand(line string) (string, bool, error) {
+	switch {
+	case line == "!!":
+		cmd, err := h.recall(1)
+		return cmd, true, err
+	case len(line) > 1 && line[0] == '!':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", true, noCommand
+		}
+		cmd, err := h.recall(len(h.entries) - n + 1)
+		return cmd, true, err
+	}
+
+	return line, false, nil
+}
+
+// editLine reads a line from in a key at a time and echoes it to out, for
+// a terminal that has been told not to. The up and down arrows step
+// through the commands in h, which may be nil, backspace deletes, ctrl-C
+// abandons the line and ctrl-D on an empty line ends the input. The line
+// is returned with surrounding whitespace removed.
+func editLine(in *bufio.Reader, out io.Writer, h *commandHistory) (string, error) {
+	var entries []string
+	if h != nil {
+		entries = h.entries
+	}
+
+	var line, draft []byte
+	pos := len(entries) // the entry shown; len(entries) for a new line
+	show := func(s []byte) {
+		fmt.Fprint(out, strings.Repeat("\b", len(line))+"\x1b[K")
+		line = append(line[:0], s...)
+		out.Write(line)
+	}
+
+	for {
+		c, err := in.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				err = nil
+			}
+			return strings.TrimSpace(string(line)), err
+		}
+
+		switch c {
+		case '\r', '\n':
+			fmt.Fprintln(out)
+			return strings.TrimSpace(string(line)), nil
+		case ctrlC:
+			fmt.Fprintln(out, "^C")
+			return "", nil
+		case ctrlD:
+			if len(line) == 0 {
+				fmt.Fprintln(out)
+				return "", io.EOF
+			}
+		case backspace, del:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				fmt.Fprint(out, "\b \b")
+			}
+		case escape:
+			// The arrows are ESC [ A to D, or ESC O A to D in
+			// application cursor mode.
+			seq := make([]byte, 2)
+			if _, err := io.ReadFull(in, seq); err != nil || (seq[0] != '[' && seq[0] != 'O') {
+				continue
+			}
+			switch {
+			case seq[1] == 'A' && pos > 0:
+				if pos == len(entries) {
+					draft = append(draft[:0], line...)
+				}
+				pos--
+				show([]byte(entries[pos]))
+			case seq[1] == 'B' && pos < len(entries):
+				pos++
+				if pos == len(entries) {
+					show(draft)
+				} else {
+					show([]byte(entries[pos]))
+				}
+			}
+		default:
+			if c >= ' ' && c < del {
+				line = append(line, c)
+				out.Write([]byte{c})
+			}
+		}
+	}
+}
+
+// list writes the history to w, numbered for recall with "!n".
+func (h *commandHistory) list(w io.Writer) {
+	for i, cmd := range h.entries {
+		fmt.Fprintf(w, "%4d  %s\n", i+1, cmd)
+	}
+}
+
+// loadCommandHistory reads a history saved by saveCommandHistory, one
+// command per line. A missing file is an empty history.
+func loadCommandHistory(path string) (*commandHistory, error) {
+	h := &commandHistory{}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		h.add(strings.TrimSpace(s.Text()))
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history: %v", err)
+	}
+
+	return h, nil
+}
+
+// saveCommandHistory writes h to the file at path, one command per line.
+func saveCommandHistory(h *commandHistory, path string) error {
+	var sb strings.Builder
+	for _, cmd := range h.entries {
+		fmt.Fprintln(&sb, cmd)
+	}
+
+	return os.WriteFile(path, []byte(sb.String()), 0644)
+}
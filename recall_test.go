@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandHistory(t *testing.T) {
+	h := &commandHistory{}
+	for _, cmd := range []string{"S", "S", "", "P 5 1", "R"} {
+		h.add(cmd)
+	}
+	if want := []string{"S", "P 5 1", "R"}; !reflect.DeepEqual(h.entries, want) {
+		t.Errorf("entries = %q, want %q", h.entries, want)
+	}
+
+	cases := []struct {
+		line         string
+		want         string
+		wantRecalled bool
+		wantErr      error
+	}{
+		{"S", "S", false, nil},
+		{"!!", "R", true, nil},
+		{"!1", "S", true, nil},
+		{"!3", "R", true, nil},
+		{"!0", "", true, noCommand},
+		{"!4", "", true, noCommand},
+		{"!x", "", true, noCommand},
+	}
+
+	for i, tc := range cases {
+		got, recalled, err := h.expand(tc.line)
+		if got != tc.want || recalled != tc.wantRecalled || err != tc.wantErr {
+			t.Errorf("case %d: got(%q, %t, %v) != want(%q, %t, %v)", i, got, recalled, err, tc.want, tc.wantRecalled, tc.wantErr)
+		}
+	}
+
+	var sb strings.Builder
+	h.list(&sb)
+	if want := "   1  S\n   2  P 5 1\n   3  R\n"; sb.String() != want {
+		t.Errorf("list = %q, want %q", sb.String(), want)
+	}
+
+	for i := 0; i < maxCommands+10; i++ {
+		h.add(fmt.Sprint(i))
+	}
+	if len(h.entries) != maxCommands || h.entries[0] != "10" {
+		t.Errorf("kept %d entries starting %q, want %d starting \"10\"", len(h.entries), h.entries[0], maxCommands)
+	}
+}
+
+func TestCommandHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, err := loadCommandHistory(path)
+	if err != nil || len(h.entries) != 0 {
+		t.Fatalf("loading a missing file = %q, %v, want an empty history", h.entries, err)
+	}
+
+	h.add("S")
+	h.add("K +5")
+	if err := saveCommandHistory(h, path); err != nil {
+		t.Fatalf("saveCommandHistory: unexpected error: %v", err)
+	}
+	got, err := loadCommandHistory(path)
+	if err != nil {
+		t.Fatalf("loadCommandHistory: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got.entries, h.entries) {
+		t.Errorf("reloaded %q, want %q", got.entries, h.entries)
+	}
+}
+
+func TestEditLine(t *testing.T) {
+	h := &commandHistory{}
+	for _, cmd := range []string{"S", "P 5 1", "R"} {
+		h.add(cmd)
+	}
+
+	cases := []struct {
+		keys    string
+		want    string
+		wantErr error
+	}{
+		{"S\n", "S", nil},
+		{"  G 5 \r", "G 5", nil},
+		{"\x1b[A\n", "R", nil},
+		{"\x1bOA\x1b[A\n", "P 5 1", nil},
+		{"\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\n", "S", nil},
+		{"\x1b[A\x1b[A\x1b[B\n", "R", nil},
+		{"Z 4\x1b[A\x1b[B\n", "Z 4", nil},
+		{"\x1b[B\x1b[C\n", "", nil},
+		{"PX\x7f 2 1\n", "P 2 1", nil},
+		{"\x1b[AX\b\b5\n", "5", nil},
+		{"S\x03", "", nil},
+		{"x\x04\n", "x", nil},
+		{"\x04", "", io.EOF},
+		{"S", "S", nil},
+		{"", "", io.EOF},
+	}
+
+	for i, tc := range cases {
+		got, err := editLine(bufio.NewReader(strings.NewReader(tc.keys)), io.Discard, h)
+		if got != tc.want || err != tc.wantErr {
+			t.Errorf("case %d: got(%q, %v) != want(%q, %v)", i, got, err, tc.want, tc.wantErr)
+		}
+	}
+
+	var out strings.Builder
+	editLine(bufio.NewReader(strings.NewReader("GX\x7f\x1b[A\n")), &out, h)
+	if want := "GX\b \b\b\x1b[KR\n"; out.String() != want {
+		t.Errorf("echoed %q, want %q", out.String(), want)
+	}
+	if got, err := editLine(bufio.NewReader(strings.NewReader("\x1b[A\n")), io.Discard, nil); got != "" || err != nil {
+		t.Errorf("without a history got(%q, %v) != want(\"\", nil)", got, err)
+	}
+}
+
+func TestREPLRecall(t *testing.T) {
+	b := NewBaby(loopMem())
+	out := runREPL(t, b, "S\nP 20 5\n!!\n!1\n!2\n!9\n!\nQ\n")
+
+	if b.cycles != 2 || b.mem[20] != 5 {
+		t.Errorf("after recall: cycles(%d), mem[20](%d), want 2 and 5", b.cycles, b.mem[20])
+	}
+	if !strings.Contains(out, noCommand.Error()) {
+		t.Errorf("bad recall not reported:\n%s", out)
+	}
+	if !strings.Contains(out, "   1  S\n   2  P 20 5\n   3  S\n   4  P 20 5\n") {
+		t.Errorf("history not listed:\n%s", out)
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	replPrompt = "(R)un, (S)tep, R(e)set, Re(b)oot, (C)lear, (V)isual edit, (A)ssemble, (D)ump, E(x)port, (L)oad, (+) force running, (P)oke, (Z)ero, (G)oto, Brea(k), (W)atch, (T)race, (I)nfo, (H)elp, (Q)uit: "
+	asmPrompt  = "asm> "
+
+	stableWindow = 10     // steps run-until-stable waits by default
+	stableLimit  = 100000 // steps run-until-stable runs before giving up
+	replHelp     = `Commands:
+  R    run until the machine stops
+  S    execute a single step
+  E    reset the registers, keeping the store
+  B    reboot: reload the original program and reset
+  C    clear the store and the registers
+  V    edit the store in $EDITOR and load it back
+  A    assemble lines like "0005 SUB 30" straight into the store, until
+       an empty line
+  D    D file: write the store to file (every word with -full)
+  X    X file: write the store to file as commented assembly
+  L    L file: load the program in file and reboot
+  +    force the machine to keep running, even after a STP
+  P    P addr value: set the word at addr to value
+  Z    Z addr: set the word at addr to zero
+  G    G label|addr: make the label or addr the next instruction
+       executed (also goto)
+  K    K +addr: stop before executing addr; K -addr: remove the
+       breakpoint; K alone lists breakpoints
+  W    W +addr r|w: stop after a read or write of addr; W +addr bN: stop
+       when a store flips bit N of addr; W -addr: remove the watchpoints
+       on addr; W alone lists watchpoints
+  shift
+       shift addr n: rotate the bits of the word at addr n places
+       right as displayed, or left for a negative n
+  run-until-stable
+       run-until-stable [window]: step until the accumulator is
+       unchanged for window steps (default 10) or the machine stops
+  protect
+       protect lo hi: stop before any STO to lines lo to hi; protect
+       alone lists protected lines, unprotect removes them
+  explain
+       explain addr: describe what the instruction at addr would do,
+       without running it
+  T    T file: write a trace of every step to file; T alone stops tracing
+  I    show an annotated dump of the store
+  !    list the commands entered so far; !! repeats the last, !n
+       repeats command n of the list; at a terminal the up and down
+       arrows step through them
+  H    show this help
+  Q    quit
+`
+)
+
+// RunInteractive runs the interactive command loop, reading commands from
+// the connected terminal until the user quits or the input ends.
+func (b *baby) RunInteractive() error {
+	var traceFile *os.File
+	defer func() {
+		if traceFile != nil {
+			b.SetTraceWriter(nil)
+			traceFile.Close()
+		}
+	}()
+
+	if b.cmds == nil {
+		b.cmds = &commandHistory{}
+	}
+
+	out := b.writer()
+	defer enterScreen(out)()
+
+	redraw := true
+	for {
+		if redraw {
+			b.Display()
+		}
+		redraw = true
+		if traceFile != nil {
+			fmt.Fprint(out, "[trace ON] ")
+		}
+		fmt.Fprint(out, replPrompt)
+
+		line, err := b.readCommand()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if line == "!" {
+			b.cmds.list(out)
+			redraw = false
+			continue
+		}
+		cmd, recalled, err := b.cmds.expand(line)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			redraw = false
+			continue
+		}
+		if recalled {
+			fmt.Fprintln(out, cmd)
+		}
+		line = cmd
+		b.cmds.add(line)
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "r":
+			b.Run()
+		case "s":
+			inst, err := b.Step()
+			if err != nil {
+				fmt.Fprintln(out, err)
+			} else {
+				fmt.Fprintln(out, inst)
+			}
+		case "b":
+			b.RebootOriginal()
+		case "e":
+			b.Reset()
+		case "c":
+			b.Clear()
+		case "v":
+			if err := b.EditStore(os.Getenv("EDITOR")); err != nil {
+				fmt.Fprintln(out, err)
+			}
+		case "a":
+			if err := b.assembleCommand(); err != nil {
+				return err
+			}
+		case "d", "x":
+			name := strings.TrimSpace(line[len(fields[0]):])
+			text := b.mem.ToBinary()
+			if b.fullDump {
+				text = b.mem.ToFullBinary()
+			}
+			if strings.ToLower(fields[0]) == "x" {
+				text = b.mem.ToListing()
+			}
+			if name == "" {
+				fmt.Fprintf(out, "usage: %s file\n", strings.ToUpper(fields[0]))
+			} else if err := os.WriteFile(name, []byte(text), 0644); err != nil {
+				fmt.Fprintln(out, err)
+			} else {
+				fmt.Fprintf(out, "store written to %s\n", name)
+			}
+			redraw = false
+		case "l":
+			name := strings.TrimSpace(line[len(fields[0]):])
+			if name == "" {
+				fmt.Fprintln(out, "usage: L file")
+				redraw = false
+			} else if err := b.LoadProgram(name); err != nil {
+				fmt.Fprintln(out, err)
+				redraw = false
+			}
+		case "+":
+			// Carry on past a STP, for instance after patching it away.
+			b.running = true
+		case "p":
+			args, err := intArgs(fields[1:], 2)
+			if err != nil {
+				fmt.Fprintln(out, "usage: P addr value:", err)
+				redraw = false
+				continue
+			}
+			old, err := b.PokeMem(args[0], args[1])
+			if err != nil {
+				fmt.Fprintln(out, err)
+				redraw = false
+				continue
+			}
+			fmt.Fprintf(out, "%04d: %d -> %d\n", args[0], old, args[1])
+		case "z":
+			args, err := intArgs(fields[1:], 1)
+			if err != nil {
+				fmt.Fprintln(out, "usage: Z addr:", err)
+				redraw = false
+				continue
+			}
+			old, err := b.PokeMem(args[0], 0)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				redraw = false
+				continue
+			}
+			fmt.Fprintf(out, "%04d: %d -> 0\n", args[0], old)
+		case "g", "goto":
+			var (
+				addr int32
+				err  error
+			)
+			if len(fields) != 2 {
+				err = fmt.Errorf("want 1 argument, got %d", len(fields)-1)
+			} else {
+				addr, err = b.resolveTarget(fields[1])
+			}
+			if err != nil {
+				fmt.Fprintln(out, "usage: G label|addr:", err)
+				redraw = false
+				continue
+			}
+			b.SetCI(addr - 1)
+		case "shift":
+			args, err := intArgs(fields[1:], 2)
+			var w int32
+			if err == nil {
+				w, err = b.PeekMem(args[0])
+			}
+			if err != nil {
+				fmt.Fprintln(out, "usage: shift addr n:", err)
+				redraw = false
+				continue
+			}
+			b.PokeMem(args[0], rotateWord(w, int(args[1])))
+		case "k":
+			if err := b.breakCommand(fields[1:]); err != nil {
+				fmt.Fprintln(out, "usage: K [+addr|-addr]:", err)
+			}
+			redraw = false
+		case "w":
+			if err := b.watchCommand(fields[1:]); err != nil {
+				fmt.Fprintln(out, "usage: W [+addr r|w|-addr]:", err)
+			}
+			redraw = false
+		case "t":
+			if traceFile != nil {
+				b.SetTraceWriter(nil)
+				if err := traceFile.Close(); err != nil {
+					fmt.Fprintln(out, err)
+				}
+				traceFile = nil
+			}
+			if name := strings.TrimSpace(line[len(fields[0]):]); name != "" {
+				f, err := os.Create(name)
+				if err != nil {
+					fmt.Fprintln(out, err)
+					redraw = false
+					continue
+				}
+				traceFile = f
+				b.SetTraceWriter(f)
+			}
+		case "run-until-stable":
+			window := stableWindow
+			if len(fields) > 1 {
+				args, err := intArgs(fields[1:], 1)
+				if err != nil {
+					fmt.Fprintln(out, "usage: run-until-stable [window]:", err)
+					redraw = false
+					continue
+				}
+				window = int(args[0])
+			}
+			n, err := b.RunUntilStable(window, stableLimit)
+			if err != nil {
+				fmt.Fprintf(out, "after %d steps: %v\n", n, err)
+			} else {
+				fmt.Fprintf(out, "acc stable at %d after %d steps\n", b.acc, n)
+			}
+		case "protect":
+			if err := b.protectCommand(fields[1:]); err != nil {
+				fmt.Fprintln(out, "usage: protect [lo hi]:", err)
+			}
+			redraw = false
+		case "unprotect":
+			b.Unprotect()
+			redraw = false
+		case "explain":
+			args, err := intArgs(fields[1:], 1)
+			var w int32
+			if err == nil {
+				w, err = b.PeekMem(args[0])
+			}
+			if err != nil {
+				fmt.Fprintln(out, "usage: explain addr:", err)
+			} else {
+				inst := instFromWord(w)
+				fmt.Fprintf(out, "%04d %s: %s\n", args[0], inst, Describe(inst))
+			}
+			redraw = false
+		case "i":
+			fmt.Fprint(out, b.AnnotatedDump())
+			redraw = false
+		case "h":
+			fmt.Fprint(out, replHelp)
+			redraw = false
+		case "q":
+			return nil
+		}
+	}
+}
+
+// assembleCommand reads lines of assembly from the terminal, writing each
+// one into the store as soon as it is entered, until an empty line. Lines
+// that don't parse are reported and skipped.
+func (b *baby) assembleCommand() error {
+	out := b.writer()
+	for {
+		fmt.Fprint(out, asmPrompt)
+		line, err := b.readCommand()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			return nil
+		}
+
+		addr, inst, err := instructionFromCode(line)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		old, err := b.PokeMem(addr, inst.toInt32())
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		fmt.Fprintf(out, "%04d: %d -> %d\n", addr, old, inst.toInt32())
+	}
+}
+
+// resolveTarget returns the address of a label in the loaded program, or
+// of a decimal address, checking that it is in the store.
+func (b *baby) resolveTarget(arg string) (int32, error) {
+	if addr, ok := b.labels[arg]; ok {
+		return addr, nil
+	}
+	if isLabel(arg) {
+		return 0, fmt.Errorf("%v %q", unknownLabel, arg)
+	}
+
+	addr, err := parseDecimal(arg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", arg)
+	}
+	if addr < 0 || addr >= words {
+		return 0, badAddress
+	}
+
+	return addr, nil
+}
+
+// intArgs parses exactly n decimal integer arguments.
+func intArgs(fields []string, n int) ([]int32, error) {
+	if len(fields) != n {
+		return nil, fmt.Errorf("want %d arguments, got %d", n, len(fields))
+	}
+
+	args := make([]int32, n)
+	for i, f := range fields {
+		v, err := strconv.ParseInt(f, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", f)
+		}
+		args[i] = int32(v)
+	}
+
+	return args, nil
+}
+
+// breakCommand adds, removes or lists breakpoints.
+func (b *baby) breakCommand(args []string) error {
+	if len(args) == 0 {
+		for _, addr := range b.Breakpoints() {
+			fmt.Fprintf(b.writer(), "break %04d\n", addr)
+		}
+		return nil
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("want at most 1 argument, got %d", len(args))
+	}
+
+	add, addr, err := changeArg(args[0])
+	if err != nil {
+		return err
+	}
+	if !add {
+		b.RemoveBreakpoint(addr)
+		return nil
+	}
+
+	return b.AddBreakpoint(addr)
+}
+
+// watchCommand adds, removes or lists watchpoints.
+func (b *baby) watchCommand(args []string) error {
+	if len(args) == 0 {
+		w := b.Watchpoints()
+		for _, addr := range sortedAddrs(w) {
+			fmt.Fprintf(b.writer(), "watch %04d %s\n", addr, w[addr])
+		}
+		bits := b.BitWatches()
+		for _, addr := range sortedAddrs(bits) {
+			for _, bit := range bits[addr] {
+				fmt.Fprintf(b.writer(), "watch %04d b%d\n", addr, bit)
+			}
+		}
+		return nil
+	}
+
+	add, addr, err := changeArg(args[0])
+	if err != nil {
+		return err
+	}
+	if !add {
+		if len(args) != 1 {
+			return fmt.Errorf("want 1 argument, got %d", len(args))
+		}
+		b.RemoveWatchpoint(addr)
+		return nil
+	}
+
+	if len(args) != 2 {
+		return fmt.Errorf("want 2 arguments, got %d", len(args))
+	}
+	var kind watchKind
+	switch access := strings.ToLower(args[1]); access {
+	case "r":
+		kind = watchRead
+	case "w":
+		kind = watchWrite
+	default:
+		if !strings.HasPrefix(access, "b") {
+			return fmt.Errorf("invalid access %q", args[1])
+		}
+		bit, err := strconv.Atoi(access[1:])
+		if err != nil {
+			return badBit
+		}
+		return b.AddBitWatch(addr, bit)
+	}
+
+	return b.AddWatchpoint(addr, kind)
+}
+
+// protectCommand protects a range of lines or lists the protected ranges.
+func (b *baby) protectCommand(args []string) error {
+	if len(args) == 0 {
+		for _, r := range b.ProtectedRegions() {
+			fmt.Fprintf(b.writer(), "protect %04d %04d\n", r[0], r[1])
+		}
+		return nil
+	}
+
+	lohi, err := intArgs(args, 2)
+	if err != nil {
+		return err
+	}
+
+	return b.Protect(lohi[0], lohi[1])
+}
+
+// changeArg parses a +addr or -addr argument, reporting whether it adds.
+func changeArg(arg string) (bool, int32, error) {
+	if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+		return false, 0, fmt.Errorf("invalid argument %q", arg)
+	}
+
+	addr, err := strconv.ParseInt(arg[1:], 10, 32)
+	if err != nil || addr < 0 || addr >= words {
+		return false, 0, badAddress
+	}
+
+	return arg[0] == '+', int32(addr), nil
+}
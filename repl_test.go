@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runREPL runs the interactive loop for b over input, returning the output.
+func runREPL(t *testing.T, b *baby, input string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	b.ConnectTerminal(strings.NewReader(input), &out)
+	if err := b.RunInteractive(); err != nil {
+		t.Fatalf("RunInteractive: unexpected error: %v", err)
+	}
+
+	return out.String()
+}
+
+func TestRunInteractive(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+	ran := NewBaby(mem)
+	for ran.running {
+		ran.Step()
+	}
+
+	cases := []struct {
+		input   string
+		wantCI  register
+		running bool
+		wantMem memory
+	}{
+		{"Q\n", 0, true, mem},
+		{"S\nS\nQ\n", 2, true, mem},
+		{"s\ns\ns\n", 9, true, mem}, // Input ending quits too.
+		{"R\nQ\n", 9, false, ran.mem},
+		{"R\nE\nQ\n", 0, true, ran.mem},
+		{"R\nB\nQ\n", 0, true, mem},
+		{"S\nC\nQ\n", 0, true, memory{}},
+		{"S\nQ\nS\n", 1, true, mem}, // Nothing runs after Q.
+		{"bogus\n\nS\nQ\n", 1, true, mem},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(mem)
+		runREPL(t, b, tc.input)
+		if b.ci != tc.wantCI || b.running != tc.running || b.mem != tc.wantMem {
+			t.Errorf("case %d: ci(%d) != wantCI(%d) || running(%t) != want(%t) || mem differs(%t)", i, b.ci, tc.wantCI, b.running, tc.running, b.mem != tc.wantMem)
+		}
+	}
+}
+
+func TestRunInteractiveOutput(t *testing.T) {
+	b := NewBaby(loopMem())
+	out := runREPL(t, b, "S\nQ\n")
+
+	if got := strings.Count(out, replPrompt); got != 2 {
+		t.Errorf("prompt shown %d times, want 2", got)
+	}
+	if !strings.Contains(out, "SUB 5\n") {
+		t.Errorf("output missing the stepped instruction:\n%s", out)
+	}
+}
+
+func TestForceRunning(t *testing.T) {
+	var mem memory
+	mem[1] = (&instruction{op: STP}).toInt32()
+	mem[2] = (&instruction{op: LDN, data: 5}).toInt32()
+	mem[5] = 4
+
+	b := NewBaby(mem)
+	runREPL(t, b, "R\nQ\n")
+	if b.running || b.ci != 1 {
+		t.Fatalf("after Run: running(%t) != false || ci(%d) != 1", b.running, b.ci)
+	}
+
+	runREPL(t, b, "+\nS\nQ\n")
+	if !b.running || b.ci != 2 || b.acc != -4 {
+		t.Errorf("after +: running(%t) != true || ci(%d) != 2 || acc(%d) != -4", b.running, b.ci, b.acc)
+	}
+}
+
+func TestHelpAndInfo(t *testing.T) {
+	b := NewBaby(loopMem())
+	out := runREPL(t, b, "H\nQ\n")
+	for _, c := range []string{"R", "S", "E", "B", "C", "V", "+", "P", "G", "K", "W", "I", "H", "Q"} {
+		if !strings.Contains(out, "\n  "+c+" ") {
+			t.Errorf("help missing command %q:\n%s", c, out)
+		}
+	}
+
+	b = NewBaby(loopMem())
+	var display bytes.Buffer
+	b.DisplayTo(&display)
+	out = runREPL(t, b, "I\nQ\n")
+	out = strings.Replace(out, display.String(), "", 1)
+	if got := strings.Count(out, " | 0x"); got != words {
+		t.Errorf("info showed %d address lines, want %d:\n%s", got, words, out)
+	}
+	if strings.Count(out, cursorHome) != 0 {
+		t.Errorf("info redrew the display")
+	}
+}
+
+func TestPokeAndGoto(t *testing.T) {
+	b := NewBaby(loopMem())
+	out := runREPL(t, b, "P 5 42\nQ\n")
+	if got, err := b.PeekMem(5); err != nil || got != 42 {
+		t.Errorf("PeekMem(5) = %d, %v, want 42", got, err)
+	}
+	if !strings.Contains(out, "0005: 1 -> 42\n") {
+		t.Errorf("poke didn't report the change:\n%s", out)
+	}
+
+	b = NewBaby(loopMem())
+	runREPL(t, b, "G 2\nS\nQ\n")
+	if b.ci != 0 || b.cycles != 1 {
+		t.Errorf("after G 2 and a step: ci(%d) != 0 || cycles(%d) != 1", b.ci, b.cycles)
+	}
+
+	for _, bad := range []string{"P\n", "P 5\n", "P x 1\n", "P 32 1\n", "G\n", "G -1\n", "G 32\n", "G two\n"} {
+		b = NewBaby(loopMem())
+		out := runREPL(t, b, bad+"Q\n")
+		if b.mem != loopMem() || b.ci != 0 {
+			t.Errorf("%q changed the machine", bad)
+		}
+		if !strings.Contains(out, "invalid") && !strings.Contains(out, "want") {
+			t.Errorf("%q printed no error:\n%s", bad, out)
+		}
+	}
+}
+
+func TestZeroCommand(t *testing.T) {
+	b := NewBaby(loopMem())
+	out := runREPL(t, b, "Z 5\nQ\n")
+
+	want := loopMem()
+	want[5] = 0
+	if b.mem != want {
+		t.Errorf("after Z 5 store:\n%s", b.AnnotatedDump())
+	}
+	if !strings.Contains(out, "0005: 1 -> 0\n") {
+		t.Errorf("zero didn't report the change:\n%s", out)
+	}
+
+	for _, bad := range []string{"Z\n", "Z 5 6\n", "Z x\n", "Z 32\n", "Z -1\n"} {
+		b = NewBaby(loopMem())
+		out := runREPL(t, b, bad+"Q\n")
+		if b.mem != loopMem() {
+			t.Errorf("%q changed the store", bad)
+		}
+		if !strings.Contains(out, "invalid") && !strings.Contains(out, "want") {
+			t.Errorf("%q printed no error:\n%s", bad, out)
+		}
+	}
+}
+
+func TestExplainCommand(t *testing.T) {
+	b := NewBaby(loopMem())
+	out := runREPL(t, b, "explain 1\nexplain 32\nexplain\nQ\n")
+
+	if !strings.Contains(out, "0001 SUB 5: subtract store line 5 from the accumulator\n") {
+		t.Errorf("explain 1 not described:\n%s", out)
+	}
+	if strings.Count(out, "usage: explain addr:") != 2 {
+		t.Errorf("bad addresses not reported:\n%s", out)
+	}
+	if b.cycles != 0 || b.mem != loopMem() {
+		t.Errorf("explain changed the machine")
+	}
+}
+
+func TestAssembleCommand(t *testing.T) {
+	b := NewBaby(loopMem())
+	out := runREPL(t, b, "A\n0003 STO 5\n0040 STP\n0004 FOO 1\n\nS\nQ\n")
+
+	want := loopMem()
+	want[3] = (&instruction{op: STO, data: 5}).toInt32()
+	if b.mem != want {
+		t.Errorf("store after assembling:\n%s", b.AnnotatedDump())
+	}
+	if !strings.Contains(out, "0003: 0 -> 24581\n") {
+		t.Errorf("assembling didn't report the change:\n%s", out)
+	}
+	if strings.Count(out, "invalid") != 2 {
+		t.Errorf("want 2 errors for the bad lines:\n%s", out)
+	}
+	if b.cycles != 1 {
+		t.Errorf("cycles(%d) != 1: the empty line didn't return to the REPL", b.cycles)
+	}
+}
+
+func TestGotoLabel(t *testing.T) {
+	src := `
+0001 LDN a
+again: SUB a
+       STP
+a:     NUM 1
+`
+	p, err := assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("assemble: unexpected error: %v", err)
+	}
+
+	b := newBabyFromProgram(p)
+	runREPL(t, b, "goto again\nQ\n")
+	if b.ci != 1 {
+		t.Errorf("goto again: ci(%d) != 1", b.ci)
+	}
+	b = newBabyFromProgram(p)
+	runREPL(t, b, "G again\nS\nQ\n")
+	if b.ci != 2 || b.acc != -1 {
+		t.Errorf("G again and a step: ci(%d) != 2 || acc(%d) != -1", b.ci, b.acc)
+	}
+
+	for _, bad := range []string{"goto nowhere\n", "goto 32\n", "goto\n", "goto again 1\n"} {
+		b = newBabyFromProgram(p)
+		out := runREPL(t, b, bad+"Q\n")
+		if b.ci != 0 {
+			t.Errorf("%q moved the ci to %d", bad, b.ci)
+		}
+		if !strings.Contains(out, "usage: G label|addr:") {
+			t.Errorf("%q printed no error:\n%s", bad, out)
+		}
+	}
+}
+
+func TestShift(t *testing.T) {
+	b := NewBaby(loopMem())
+	runREPL(t, b, "shift 5 2\nQ\n")
+	if b.mem[5] != 4 {
+		t.Errorf("after shift 5 2: mem[5] = %d, want 4", b.mem[5])
+	}
+
+	runREPL(t, b, "SHIFT 5 -3\nshift 5\nshift 40 1\nQ\n")
+	if b.mem[5] != math.MinInt32 {
+		t.Errorf("after shift 5 -3: mem[5] = %d, want %d", b.mem[5], math.MinInt32)
+	}
+}
+
+func TestTraceCommand(t *testing.T) {
+	trace := filepath.Join(t.TempDir(), "trace")
+	b := NewBaby(loopMem())
+	out := runREPL(t, b, "T "+trace+"\nS\nS\nS\nT\nS\nS\nS\nQ\n")
+
+	if got := strings.Count(string(readFile(t, trace)), "\n"); got != 3 {
+		t.Errorf("trace has %d lines, want 3", got)
+	}
+	if got := strings.Count(out, "[trace ON] "+replPrompt); got != 4 {
+		t.Errorf("prompt showed tracing %d times, want 4", got)
+	}
+	if b.trace != nil {
+		t.Errorf("trace writer still set")
+	}
+
+	// Tracing stops, and the file is closed, on quitting.
+	b = NewBaby(loopMem())
+	runREPL(t, b, "T "+trace+"\nS\nQ\n")
+	if b.trace != nil || strings.Count(string(readFile(t, trace)), "\n") != 1 {
+		t.Errorf("tracing not stopped on quit")
+	}
+}
+
+func TestDumpAndLoad(t *testing.T) {
+	dump := filepath.Join(t.TempDir(), "dump.baby")
+	b := NewBaby(loopMem())
+	out := runREPL(t, b, "D "+dump+"\nP 5 42\nL "+dump+"\nQ\n")
+
+	if b.mem != loopMem() || b.initialMem != loopMem() {
+		t.Errorf("store not restored from the dump:\n%s", b.AnnotatedDump())
+	}
+	if !strings.Contains(out, "store written to "+dump) {
+		t.Errorf("dump didn't report success:\n%s", out)
+	}
+
+	mem := loopMem()
+	b = NewBaby(mem)
+	b.fullDump = true
+	runREPL(t, b, "D "+dump+"\nQ\n")
+	if got := string(readFile(t, dump)); got != mem.ToFullBinary() {
+		t.Errorf("full dump = %q, want every word", got)
+	}
+
+	export := filepath.Join(t.TempDir(), "export.baby")
+	b = NewBaby(loopMem())
+	runREPL(t, b, "X "+export+"\nP 5 42\nL "+export+"\nQ\n")
+	if b.mem != loopMem() {
+		t.Errorf("store not restored from the export:\n%s", b.AnnotatedDump())
+	}
+	if !strings.HasPrefix(string(readFile(t, export)), ";") {
+		t.Errorf("export isn't commented:\n%s", readFile(t, export))
+	}
+
+	b = NewBaby(loopMem())
+	out = runREPL(t, b, "L "+filepath.Join(t.TempDir(), "missing")+"\nD\nL\nX\nQ\n")
+	if b.mem != loopMem() {
+		t.Errorf("failed load changed the store")
+	}
+	if !strings.Contains(out, "no such file") || !strings.Contains(out, "usage: D file") || !strings.Contains(out, "usage: L file") || !strings.Contains(out, "usage: X file") {
+		t.Errorf("missing errors:\n%s", out)
+	}
+}
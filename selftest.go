@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// highestFactorProgram is Kilburn's highest factor routine, the first
+// program the Baby ran in June 1948, as it is usually reproduced: it finds
+// the highest proper factor of the number whose negative is in line 23 by
+// trying each divisor in turn, counting down from the one in line 24, and
+// dividing by repeated subtraction. It stops with the factor in line 27.
+const highestFactorProgram = `
+0001 LDN 24 ; begin with the divisor b in line 24
+0002 STO 26 ; line 26 = -b
+0003 LDN 26
+0004 STO 27 ; line 27 = b
+0005 LDN 23 ; acc = n
+0006 SUB 27 ; subtract b until the remainder goes negative
+0007 CMP
+0008 JRP 20 ; back to line 6
+0009 SUB 26 ; add b back: acc = n mod b
+0010 STO 25
+0011 LDN 25
+0012 CMP    ; a remainder is a failure; a zero one means b is the factor
+0013 STP
+0014 LDN 26 ; try b - 1
+0015 SUB 21
+0016 STO 27
+0017 LDN 27
+0018 STO 26
+0019 JMP 22 ; back to line 5
+0020 NUM -3
+0021 NUM 1
+0022 NUM 4
+`
+
+const (
+	// highestFactorInput is the number the program was first run on, 2^18.
+	highestFactorInput = 1 << 18
+
+	// highestFactorSteps is how long the self-test lets the program run by
+	// default. Dividing by repeated subtraction, 2^18 takes about two
+	// million steps, but a large prime takes billions.
+	highestFactorSteps = 100_000_000
+)
+
+var (
+	badFactorInput = errors.New("invalid self-test - want a number above 1 that fits in a word")
+	wrongFactor    = errors.New("invalid self-test - wrong highest factor")
+)
+
+// runHighestFactor runs the highest factor program on n, starting from the
+// divisor n-1, and returns the factor it finds and the steps it took. It
+// gives up with tooManySteps after maxSteps steps, if that is above 0.
+func runHighestFactor(n, maxSteps int64) (int32, int64, error) {
+	if n < 2 || n > math.MaxInt32 {
+		return 0, 0, badFactorInput
+	}
+
+	p, err := assemble(strings.NewReader(highestFactorProgram))
+	if err != nil {
+		return 0, 0, err
+	}
+	p.mem[23], p.mem[24] = int32(-n), int32(n-1)
+
+	b := newBabyFromProgram(p)
+	b.SetHistoryDepth(0)
+	b.SetMaxSteps(maxSteps)
+	if err := b.RunN(0); errors.Is(err, tooManySteps) {
+		return 0, b.cycles, fmt.Errorf("%w: no factor of %d after %d steps", err, n, b.cycles)
+	} else if err != nil {
+		return 0, b.cycles, err
+	}
+
+	return b.mem[27], b.cycles, nil
+}
+
+// highestFactor returns the highest proper factor of n, the answer the
+// program should reach.
+func highestFactor(n int32) int32 {
+	for d := n / 2; d > 1; d-- {
+		if n%d == 0 {
+			return d
+		}
+	}
+
+	return 1
+}
+
+// verifyHighestFactor runs the highest factor program on n for at most
+// maxSteps steps and checks its answer, returning wrongFactor if the
+// emulation doesn't reach it.
+func verifyHighestFactor(n, maxSteps int64) (int32, int64, error) {
+	got, steps, err := runHighestFactor(n, maxSteps)
+	if err != nil {
+		return got, steps, err
+	}
+	if want := highestFactor(int32(n)); got != want {
+		return got, steps, fmt.Errorf("%w: got %d for %d, want %d", wrongFactor, got, n, want)
+	}
+
+	return got, steps, nil
+}
+
+// selfTest checks the emulator against the Baby's first program, run on n
+// for at most maxSteps steps, writing the outcome to w.
+func selfTest(n, maxSteps int64, w io.Writer) error {
+	f, steps, err := verifyHighestFactor(n, maxSteps)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "highest factor of %d: %d, in %d steps\n", n, f, steps)
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHighestFactor(t *testing.T) {
+	cases := []struct {
+		n    int64
+		want int32
+	}{
+		{2, 1},
+		{12, 6},
+		{91, 13},
+		{97, 1},
+		{1000, 500},
+		{3 * 7 * 11, 77},
+	}
+
+	for i, tc := range cases {
+		got, steps, err := verifyHighestFactor(tc.n, highestFactorSteps)
+		if err != nil || got != tc.want || steps == 0 {
+			t.Errorf("case %d: got(%d, %v) after %d steps != want(%d, nil)", i, got, err, steps, tc.want)
+		}
+	}
+
+	// 2^31-1 is prime, so would take billions of steps.
+	if _, steps, err := runHighestFactor(math.MaxInt32, 1000); !errors.Is(err, tooManySteps) || steps != 1000 {
+		t.Errorf("runHighestFactor(2^31-1, 1000) = %v after %d steps, want %v after 1000", err, steps, tooManySteps)
+	}
+
+	for _, n := range []int64{1, 0, -4, 1 << 31} {
+		if _, _, err := runHighestFactor(n, 0); err != badFactorInput {
+			t.Errorf("runHighestFactor(%d) = %v, want %v", n, err, badFactorInput)
+		}
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	var out strings.Builder
+	if err := selfTest(1<<12, highestFactorSteps, &out); err != nil {
+		t.Fatalf("selfTest: unexpected error: %v", err)
+	}
+	if want := "highest factor of 4096: 2048,"; !strings.HasPrefix(out.String(), want) {
+		t.Errorf("selfTest wrote %q, want it to start %q", out.String(), want)
+	}
+
+	if err := selfTest(1, highestFactorSteps, &out); !errors.Is(err, badFactorInput) {
+		t.Errorf("selfTest(1) = %v, want %v", err, badFactorInput)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	statePrefix    = "baby-state "     // Saved states start with this and their version
+	stateHeader    = statePrefix + "2" // First line of every state this version saves
+	stateHeaderOne = statePrefix + "1" // Version 1, without beats or notes, still loads
+)
+
+var (
+	badState        = errors.New("invalid state - unrecognised saved state")
+	badStateVersion = errors.New("invalid state - saved by an unsupported version")
+)
+
+// SaveState writes the registers, store and annotations to w in a form
+// LoadState can read back.
+func (b *baby) SaveState(w io.Writer) error {
+	var sb strings.Builder
+
+	fmt.Fprintln(&sb, stateHeader)
+	fmt.Fprintf(&sb, "ci %d\n", b.ci)
+	fmt.Fprintf(&sb, "acc %d\n", b.acc)
+	fmt.Fprintf(&sb, "running %t\n", b.running)
+	fmt.Fprintf(&sb, "cycles %d\n", b.cycles)
+	fmt.Fprintf(&sb, "beats %d\n", b.beats)
+	for row := 0; row < words; row++ {
+		fmt.Fprintf(&sb, "%04d:%s\n", row, EncodeWord(b.mem[row]))
+	}
+	for _, addr := range sortedAddrs(b.annotations) {
+		fmt.Fprintf(&sb, "note %d %q\n", addr, b.annotations[addr])
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// LoadState replaces the registers, store and annotations with a state
+// previously written by SaveState. The machine is left untouched on error.
+func (b *baby) LoadState(r io.Reader) error {
+	var (
+		mem     memory
+		ci, acc int64
+		running bool
+		cycles  int64
+		beats   int64
+		notes   = make(map[int32]string)
+		err     error
+	)
+	header := true
+
+	s := bufio.NewScanner(r)
+	for i := 1; s.Scan(); i++ {
+		line := s.Text()
+		if header {
+			if line != stateHeader && line != stateHeaderOne {
+				if strings.HasPrefix(line, statePrefix) {
+					return badStateVersion
+				}
+				return badState
+			}
+			header = false
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		if strings.Contains(line, ":") {
+			n, m, err := memFromBin(line)
+			if err != nil {
+				return fmt.Errorf("error on line %d: %v", i, err)
+			}
+			mem[n] = m
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) < 2 {
+			return fmt.Errorf("error on line %d: %v", i, badState)
+		}
+		switch parts[0] {
+		case "ci":
+			ci, err = strconv.ParseInt(parts[1], 10, 32)
+		case "acc":
+			acc, err = strconv.ParseInt(parts[1], 10, 32)
+		case "running":
+			running, err = strconv.ParseBool(parts[1])
+		case "cycles":
+			cycles, err = strconv.ParseInt(parts[1], 10, 64)
+		case "beats":
+			beats, err = strconv.ParseInt(parts[1], 10, 64)
+		case "note":
+			err = parseNote(parts[1], notes)
+		default:
+			err = badState
+		}
+		if err != nil {
+			return fmt.Errorf("error on line %d: %v", i, badState)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("error reading state: %v", err)
+	}
+	if header {
+		return badState
+	}
+
+	b.initialMem = mem
+	b.source, b.labels = nil, nil
+	b.Reboot(mem)
+	b.ci, b.acc, b.running, b.cycles = register(ci), register(acc), running, cycles
+	b.beats = beats
+	b.ImportAnnotations(notes)
+
+	return nil
+}
+
+// parseNote adds the annotation in s, an address and a quoted note as
+// written by SaveState, to notes.
+func parseNote(s string, notes map[int32]string) error {
+	parts := strings.SplitN(s, " ", 2)
+	if len(parts) < 2 {
+		return badState
+	}
+	addr, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil || addr < 0 || addr >= words {
+		return badState
+	}
+	note, err := strconv.Unquote(parts[1])
+	if err != nil {
+		return badState
+	}
+
+	notes[int32(addr)] = note
+	return nil
+}
+
+// saveStateFile writes the state of b to the file at path.
+func saveStateFile(b *baby, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := b.SaveState(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// loadStateFile creates a machine from the state saved in the file at path.
+func loadStateFile(path string) (*baby, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %v", err)
+	}
+	defer f.Close()
+
+	b := NewBaby(memory{})
+	if err := b.LoadState(f); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadState(t *testing.T) {
+	b := NewBaby(loopMem())
+	for i := 0; i < 5; i++ {
+		b.Step()
+	}
+	b.mem[20] = -42
+	b.AnnotateMemory(20, "answer, \"negated\"")
+
+	var buf bytes.Buffer
+	if err := b.SaveState(&buf); err != nil {
+		t.Fatalf("SaveState: unexpected error: %v", err)
+	}
+
+	got := NewBaby(memory{})
+	if err := got.LoadState(&buf); err != nil {
+		t.Fatalf("LoadState: unexpected error: %v", err)
+	}
+	if got.mem != b.mem || got.ci != b.ci || got.acc != b.acc || got.running != b.running || got.cycles != b.cycles {
+		t.Errorf("restored state (ci %d, acc %d, running %t, cycles %d) != saved (ci %d, acc %d, running %t, cycles %d)",
+			got.ci, got.acc, got.running, got.cycles, b.ci, b.acc, b.running, b.cycles)
+	}
+	if !reflect.DeepEqual(got.ExportAnnotations(), b.ExportAnnotations()) {
+		t.Errorf("restored annotations %v != saved %v", got.ExportAnnotations(), b.ExportAnnotations())
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"0000 LDN 5\n",
+		stateHeader + "\nci x\n",
+		stateHeader + "\nbogus 1\n",
+		stateHeader + "\n0032:00000000000000000000000000000000\n",
+		statePrefix + "3\nci 1\n",
+		stateHeader + "\nnote 5\n",
+		stateHeader + "\nnote 32 \"x\"\n",
+		stateHeader + "\nnote 5 unquoted\n",
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(loopMem())
+		if err := b.LoadState(strings.NewReader(tc)); err == nil {
+			t.Errorf("case %d: LoadState(%q) succeeded, want error", i, tc)
+		}
+		if b.mem != loopMem() {
+			t.Errorf("case %d: machine modified by failed LoadState", i)
+		}
+	}
+}
+
+func TestLoadStateVersion(t *testing.T) {
+	b := NewBaby(loopMem())
+	if err := b.LoadState(strings.NewReader(statePrefix + "3\n")); err != badStateVersion {
+		t.Errorf("LoadState of a newer version = %v, want %v", err, badStateVersion)
+	}
+
+	// Version 1 states, saved before beats and notes, still load.
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\nci 3\nacc -7\nrunning true\ncycles 12\n", stateHeaderOne)
+	for row := 0; row < words; row++ {
+		fmt.Fprintf(&sb, "%04d:%s\n", row, EncodeWord(loopMem()[row]))
+	}
+	b = NewBaby(memory{})
+	if err := b.LoadState(strings.NewReader(sb.String())); err != nil {
+		t.Fatalf("LoadState of version 1: unexpected error: %v", err)
+	}
+	if b.ci != 3 || b.acc != -7 || !b.running || b.cycles != 12 || b.mem != loopMem() || b.beats != 0 {
+		t.Errorf("version 1 state loaded ci %d, acc %d, running %t, cycles %d, beats %d", b.ci, b.acc, b.running, b.cycles, b.beats)
+	}
+}
+
+func TestResume(t *testing.T) {
+	// Run one machine straight through and checkpoint another part way.
+	want := NewBaby(loopMem())
+	want.SetTiming(timingAccurate)
+	want.StepN(10)
+
+	b := NewBaby(loopMem())
+	b.SetTiming(timingAccurate)
+	b.StepN(4)
+	path := filepath.Join(t.TempDir(), "snapshot")
+	if err := saveStateFile(b, path); err != nil {
+		t.Fatalf("saveStateFile: unexpected error: %v", err)
+	}
+
+	got, err := loadStateFile(path)
+	if err != nil {
+		t.Fatalf("loadStateFile: unexpected error: %v", err)
+	}
+	got.SetTiming(timingAccurate)
+	if n, err := got.StepN(6); n != 6 || err != nil {
+		t.Fatalf("StepN(6) after resuming = %d, %v", n, err)
+	}
+
+	if got.mem != want.mem || got.ci != want.ci || got.acc != want.acc || got.cycles != want.cycles {
+		t.Errorf("resumed (ci %d, acc %d, cycles %d) != uninterrupted (ci %d, acc %d, cycles %d)",
+			got.ci, got.acc, got.cycles, want.ci, want.acc, want.cycles)
+	}
+	if got.SimulatedDuration() != want.SimulatedDuration() {
+		t.Errorf("resumed simulated time %v != uninterrupted %v", got.SimulatedDuration(), want.SimulatedDuration())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ConnectTerminal makes the machine read interactive commands from in and
+// write its display and messages to out, instead of stdin and stdout.
+func (b *baby) ConnectTerminal(in io.Reader, out io.Writer) {
+	b.in = bufio.NewReader(in)
+	b.out = out
+}
+
+// writer returns where interactive output goes.
+func (b *baby) writer() io.Writer {
+	if b.out == nil {
+		return os.Stdout
+	}
+
+	return b.out
+}
+
+// readCommand reads the next line of interactive input with surrounding
+// whitespace removed. io.EOF is returned once the input is exhausted. When
+// stdin is a terminal the line is read with editLine, so the arrows recall
+// commands; otherwise, or if the terminal can't be switched to reading a
+// key at a time, it's read as typed.
+func (b *baby) readCommand() (string, error) {
+	if b.in == nil {
+		b.in = bufio.NewReader(os.Stdin)
+		b.tty = isTerminal(os.Stdin)
+	}
+	if b.tty {
+		restore, err := keyMode()
+		if err == nil {
+			defer restore()
+			return editLine(b.in, b.writer(), b.cmds)
+		}
+		b.tty = false
+	}
+
+	line, err := b.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	return strings.TrimSpace(line), err
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// keyMode switches the terminal on stdin to passing on each key as it's
+// pressed, without echoing it or turning ctrl-C into a signal, and
+// returns a function that puts the terminal back as it was. It uses
+// stty, so fails where there isn't one.
+func keyMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1"); err != nil {
+		return nil, err
+	}
+
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+// stty runs stty with args on the terminal on stdin, returning its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+
+	return string(out), err
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConnectTerminal(t *testing.T) {
+	b := NewBaby(loopMem())
+	var out bytes.Buffer
+	b.ConnectTerminal(strings.NewReader("R\n  s  \n\nQ"), &out)
+
+	for _, want := range []string{"R", "s", "", "Q"} {
+		got, err := b.readCommand()
+		if err != nil || got != want {
+			t.Errorf("readCommand() = %q, %v, want %q", got, err, want)
+		}
+	}
+	if _, err := b.readCommand(); err != io.EOF {
+		t.Errorf("readCommand() at end of input: err(%v) != wantErr(%v)", err, io.EOF)
+	}
+
+	b.Display()
+	if !strings.Contains(out.String(), "ci: 0 (0x00000000 ") || strings.Count(out.String(), "\n") < words {
+		t.Errorf("Display wrote %q, want the machine state", out.String())
+	}
+}
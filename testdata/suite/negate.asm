@@ -0,0 +1,5 @@
+; Negate line 5 into line 6.
+0001 LDN 5
+0002 STO 6
+0003 STP
+0005 NUM 3
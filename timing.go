@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// timingModel selects how SimulatedDuration turns executed instructions
+// into time on the original machine.
+type timingModel int
+
+const (
+	timingFlat     timingModel = iota // every instruction takes flatStep
+	timingAccurate                    // instructions take opBeats beats
+)
+
+var badTiming = errors.New("invalid timing - want flat or accurate")
+
+// flatStep is the average instruction time usually quoted for the Baby:
+// about 700 instructions a second.
+const flatStep = time.Second / 700
+
+// beat is one scan of the Williams-Kilburn tube store: 32 lines of 40 bit
+// periods.
+const beat = 360 * time.Microsecond
+
+// opBeats is how many store scans each instruction takes. Every
+// instruction spends a beat incrementing the ci, one fetching the
+// instruction line and one decoding it; those that use a store line spend
+// a fourth beat reading or writing it. CMP and STP don't, so they are a
+// beat shorter.
+var opBeats = [STP + 1]int64{
+	JMP:  4,
+	JRP:  4,
+	LDN:  4,
+	STO:  4,
+	SUB:  4,
+	SUB2: 4,
+	CMP:  3,
+	STP:  3,
+}
+
+// parseTiming returns the timing model named s.
+func parseTiming(s string) (timingModel, error) {
+	switch s {
+	case "flat":
+		return timingFlat, nil
+	case "accurate":
+		return timingAccurate, nil
+	default:
+		return timingFlat, badTiming
+	}
+}
+
+// SetTiming selects the timing model used by SimulatedDuration.
+func (b *baby) SetTiming(m timingModel) {
+	b.timing = m
+}
+
+// SimulatedDuration returns how long the original machine would have taken
+// to execute the steps run since the last reset.
+func (b *baby) SimulatedDuration() time.Duration {
+	if b.timing == timingAccurate {
+		return time.Duration(b.beats) * beat
+	}
+
+	return time.Duration(b.cycles) * flatStep
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTiming(t *testing.T) {
+	cases := []struct {
+		s       string
+		want    timingModel
+		wantErr error
+	}{
+		{"flat", timingFlat, nil},
+		{"accurate", timingAccurate, nil},
+		{"fast", timingFlat, badTiming},
+		{"", timingFlat, badTiming},
+	}
+
+	for i, tc := range cases {
+		got, err := parseTiming(tc.s)
+		if got != tc.want || err != tc.wantErr {
+			t.Errorf("case %d: got(%v, %v) != want(%v, %v)", i, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestSimulatedDuration(t *testing.T) {
+	// LDN, SUB, CMP, STO, STP: three 4 beat instructions and two 3 beat ones.
+	var mem memory
+	mem[1] = (&instruction{op: LDN, data: 10}).toInt32()
+	mem[2] = (&instruction{op: SUB, data: 10}).toInt32()
+	mem[3] = (&instruction{op: CMP}).toInt32()
+	mem[4] = (&instruction{op: STO, data: 11}).toInt32()
+	mem[5] = (&instruction{op: STP}).toInt32()
+	mem[10] = -3 // Keeps the acc positive so CMP doesn't skip.
+
+	cases := []struct {
+		timing   timingModel
+		want     time.Duration
+		wantBack time.Duration // after stepping back over the STP
+	}{
+		{timingFlat, 5 * flatStep, 4 * flatStep},
+		{timingAccurate, 18 * 360 * time.Microsecond, 15 * 360 * time.Microsecond},
+	}
+
+	for i, tc := range cases {
+		b := NewWithConfig(BabyConfig{Memory: mem, Timing: tc.timing})
+		for b.running {
+			if _, err := b.Step(); err != nil {
+				t.Fatalf("case %d: Step() = %v", i, err)
+			}
+		}
+		if got := b.SimulatedDuration(); got != tc.want {
+			t.Errorf("case %d: got(%v) != want(%v)", i, got, tc.want)
+		}
+
+		b.StepBack()
+		if got := b.SimulatedDuration(); got != tc.wantBack {
+			t.Errorf("case %d: after StepBack got(%v) != want(%v)", i, got, tc.wantBack)
+		}
+
+		b.Reset()
+		if got := b.SimulatedDuration(); got != 0 {
+			t.Errorf("case %d: after Reset got(%v) != 0", i, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const traceContext = 3 // Unchanged steps shown either side of a divergence
+
+// traceOp is a step of the edit script between two traces: ' ' for a step
+// in both, '-' for one only in the first and '+' for one only in the second.
+type traceOp struct {
+	kind byte
+	e    HistoryEntry
+}
+
+// TraceDiff compares the addresses executed by two traces, matching them
+// up by longest common subsequence, and returns the first place they
+// diverge as a unified diff hunk with a few steps of context. Each line
+// gives the step, numbered as in the first trace for steps in both, the
+// address executed and the instruction there. An empty string is returned
+// if the traces execute the same addresses.
+func TraceDiff(a, b []HistoryEntry) string {
+	ops := traceEdits(a, b)
+
+	first := -1
+	for i, op := range ops {
+		if op.kind != ' ' {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	// The hunk runs from a little before the first difference to a
+	// little after the end of the run of differences it starts.
+	start := first - traceContext
+	if start < 0 {
+		start = 0
+	}
+	end := first
+	for end < len(ops) && ops[end].kind != ' ' {
+		end++
+	}
+	for n := 0; end < len(ops) && n < traceContext && ops[end].kind == ' '; n++ {
+		end++
+	}
+
+	// Both traces have the same steps before the hunk, so it starts at
+	// the same place in each.
+	var aLen, bLen int
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			aLen++
+		}
+		if op.kind != '-' {
+			bLen++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", start+1, aLen, start+1, bLen)
+	for _, op := range ops[start:end] {
+		fmt.Fprintf(&sb, "%c%4d %04d %s\n", op.kind, op.e.Cycle, op.e.CI+1, op.e.Inst)
+	}
+
+	return sb.String()
+}
+
+// traceEdits returns the edit script turning the addresses executed by a
+// into those executed by b.
+func traceEdits(a, b []HistoryEntry) []traceOp {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i].CI == b[j].CI:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []traceOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].CI == b[j].CI:
+			ops = append(ops, traceOp{' ', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, traceOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, traceOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, traceOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, traceOp{'+', b[j]})
+	}
+
+	return ops
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+// traceOf returns a trace executing addrs in turn, each holding a SUB of
+// its own address.
+func traceOf(addrs ...int32) []HistoryEntry {
+	var t []HistoryEntry
+	for i, a := range addrs {
+		t = append(t, HistoryEntry{Cycle: int64(i + 1), CI: register(a - 1), Inst: &instruction{op: SUB, data: a}})
+	}
+	return t
+}
+
+func TestTraceDiff(t *testing.T) {
+	loop := []int32{1, 2, 1, 2, 1, 2, 1, 2, 1, 2}
+
+	cases := []struct {
+		a, b []HistoryEntry
+		want string
+	}{
+		{traceOf(loop...), traceOf(loop...), ""},
+		{nil, nil, ""},
+		// Identical for 10 steps, then different addresses.
+		{traceOf(append(loop, 1, 2, 3)...), traceOf(append(loop, 4, 5)...), "" +
+			"@@ -8,6 +8,5 @@\n" +
+			"    8 0002 SUB 2\n" +
+			"    9 0001 SUB 1\n" +
+			"   10 0002 SUB 2\n" +
+			"-  11 0001 SUB 1\n" +
+			"-  12 0002 SUB 2\n" +
+			"-  13 0003 SUB 3\n" +
+			"+  11 0004 SUB 4\n" +
+			"+  12 0005 SUB 5\n"},
+		// A skipped step, then back in step with context after it.
+		{traceOf(1, 2, 3, 4, 5, 6, 7, 8), traceOf(1, 3, 4, 5, 6, 7, 8), "" +
+			"@@ -1,5 +1,4 @@\n" +
+			"    1 0001 SUB 1\n" +
+			"-   2 0002 SUB 2\n" +
+			"    3 0003 SUB 3\n" +
+			"    4 0004 SUB 4\n" +
+			"    5 0005 SUB 5\n"},
+		// One trace stops early.
+		{traceOf(1, 2, 3), traceOf(1, 2), "" +
+			"@@ -1,3 +1,2 @@\n" +
+			"    1 0001 SUB 1\n" +
+			"    2 0002 SUB 2\n" +
+			"-   3 0003 SUB 3\n"},
+	}
+
+	for i, tc := range cases {
+		if got := TraceDiff(tc.a, tc.b); got != tc.want {
+			t.Errorf("case %d: got:\n%s\nwant:\n%s", i, got, tc.want)
+		}
+	}
+}
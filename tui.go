@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Terminal control sequences used by the display.
+const (
+	altScreenOn  = "\033[?1049h" // switch to the alternate screen buffer
+	altScreenOff = "\033[?1049l" // return to the normal screen buffer
+	cursorHome   = "\033[H"
+	clearLine    = "\033[K" // clear from the cursor to the end of the line
+	clearBelow   = "\033[J" // clear from the cursor to the end of the screen
+	colourReset  = "\033[0m"
+)
+
+// heatColours are the colours of the heatmap's buckets, from lines never
+// executed, left uncoloured, to the hottest.
+var heatColours = []string{
+	"",
+	"\033[34m", // blue
+	"\033[36m", // cyan
+	"\033[33m", // yellow
+	"\033[31m", // red
+}
+
+// screenChrome is the number of rows the display uses besides the store:
+// the status line above it and the blank line and command bar below it.
+const screenChrome = 3
+
+// terminalRows returns the height of the terminal on stdin, as given by
+// stty size, falling back to $LINES, which shells set but don't usually
+// export. It returns 0 if the height isn't known.
+func terminalRows() int {
+	if out, err := stty("size"); err == nil {
+		if n, ok := sizeRows(out); ok {
+			return n
+		}
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LINES"))
+	if err != nil || n < 0 {
+		return 0
+	}
+
+	return n
+}
+
+// sizeRows returns the rows from the output of stty size, "rows columns".
+func sizeRows(out string) (int, bool) {
+	f := strings.Fields(out)
+	if len(f) != 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(f[0])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// enterScreen switches w to the alternate screen buffer, returning a
+// function that restores the normal screen.
+func enterScreen(w io.Writer) func() {
+	fmt.Fprint(w, altScreenOn)
+	return func() { fmt.Fprint(w, altScreenOff) }
+}
+
+// screenLines lays out the display for a terminal of the given height:
+// the status line, which stays fixed at the top, then as much of the store
+// as fits, scrolled to keep ci in view, and a blank line above the command
+// bar. A height of 0 shows the whole store.
+func (b *baby) screenLines(rows int) []string {
+	n := words
+	if rows > 0 && rows-screenChrome < n {
+		n = rows - screenChrome
+		if n < 1 {
+			n = 1
+		}
+	}
+
+	lines := []string{b.registerLine()}
+	for row, top := 0, scrollTop(int(b.ci), n); row < n; row++ {
+		lines = append(lines, b.storeLine(top+row))
+	}
+
+	return append(lines, "")
+}
+
+// registerLine describes the registers, each in decimal, hex and binary,
+// followed by the instruction the next step will execute and, when
+// showAccAddr is set, the store line acc refers to as an address.
+func (b *baby) registerLine() string {
+	s := fmt.Sprintf("ci: %s, acc: %s, running: %t", formatRegister(b.ci), formatRegister(b.acc), b.running)
+	if _, inst := b.NextStep(); inst != nil {
+		s += fmt.Sprintf(", next: %s", inst)
+	}
+	if b.showAccAddr {
+		addr := accAddress(b.acc)
+		s += fmt.Sprintf(", acc -> %04d: %d [%s]", addr, b.mem[addr], instFromWord(b.mem[addr]))
+	}
+
+	return s
+}
+
+// accAddress returns the store line acc names when used as an address, as
+// an instruction's operand would be: its low 5 bits.
+func accAddress(acc register) int32 {
+	return int32(acc) & (words - 1)
+}
+
+// formatRegister returns v in decimal, then hex and binary, least
+// significant bit first, as the machine shows it.
+func formatRegister(v register) string {
+	return fmt.Sprintf("%d (0x%08X %s)", v, uint32(v), EncodeWord(int32(v)))
+}
+
+// scrollTop returns the first store line of an n line window that keeps
+// row roughly centred.
+func scrollTop(row, n int) int {
+	top := row - n/2
+	if top > words-n {
+		top = words - n
+	}
+	if top < 0 {
+		top = 0
+	}
+
+	return top
+}
+
+// heatBucket maps a line's execution count to an index into heatColours,
+// scaled so that only the most executed lines, those run max times, land
+// in the hottest bucket. Lines never executed are in bucket 0.
+func heatBucket(count, max int64) int {
+	if count <= 0 || max <= 0 {
+		return 0
+	}
+
+	hot := int64(len(heatColours) - 1)
+	return int((count*hot + max - 1) / max)
+}
+
+// colour wraps s in the terminal colour code, or returns it unchanged if
+// code is empty.
+func colour(s, code string) string {
+	if code == "" {
+		return s
+	}
+
+	return code + s + colourReset
+}
+
+// heatLine colours a store line by how often row has been executed since
+// the last reset.
+func (b *baby) heatLine(row int, line string) string {
+	var max int64
+	for _, n := range b.addrCounts {
+		if n > max {
+			max = n
+		}
+	}
+
+	return colour(line, heatColours[heatBucket(b.addrCounts[row], max)])
+}
+
+// dots draws w as the tube shows it, least significant bit first, with
+// "#" for a lit dot and "." for a dark one. A 1 bit is lit unless invert
+// selects the negative logic convention, where a 0 bit is.
+func dots(w int32, invert bool) string {
+	lit, dark := "1", "0"
+	if invert {
+		lit, dark = dark, lit
+	}
+
+	return strings.NewReplacer(lit, "#", dark, ".").Replace(EncodeWord(w))
+}
+
+// storeLine draws a single line of the store, marking the ci and followed
+// by any annotation, and coloured by execution count when the heatmap is
+// on.
+func (b *baby) storeLine(row int) string {
+	ind := ""
+	if row == int(b.ci) {
+		ind = " <=="
+	}
+
+	line := fmt.Sprintf("%04d:%32s | %4s [%-8s ; %12d]", row, dots(b.mem[row], b.invertDots), ind, instFromWord(b.mem[row]), b.mem[row])
+	if note := b.annotations[int32(row)]; note != "" {
+		line += " " + note
+	}
+	if b.heatmap {
+		line = b.heatLine(row, line)
+	}
+
+	return line
+}
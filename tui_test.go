@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestScrollTop(t *testing.T) {
+	cases := []struct {
+		row, n int
+		want   int
+	}{
+		{0, words, 0},
+		{20, words, 0},
+		{0, 10, 0},
+		{4, 10, 0},
+		{15, 10, 10},
+		{31, 10, 22},
+		{-1, 10, 0},
+		{40, 10, 22},
+	}
+
+	for i, tc := range cases {
+		if got := scrollTop(tc.row, tc.n); got != tc.want {
+			t.Errorf("case %d: got(%d) != want(%d)", i, got, tc.want)
+		}
+	}
+}
+
+func TestSizeRows(t *testing.T) {
+	cases := []struct {
+		out    string
+		want   int
+		wantOK bool
+	}{
+		{"24 80\n", 24, true},
+		{"50 132", 50, true},
+		{"0 0\n", 0, false},
+		{"", 0, false},
+		{"x 80\n", 0, false},
+		{"24\n", 0, false},
+	}
+
+	for i, tc := range cases {
+		if got, ok := sizeRows(tc.out); got != tc.want || ok != tc.wantOK {
+			t.Errorf("case %d: got(%d, %t) != want(%d, %t)", i, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestScreenLines(t *testing.T) {
+	cases := []struct {
+		rows, ci  int
+		wantLines int
+		wantFirst string // first store line shown
+	}{
+		{0, 0, words + 2, "0000:"},
+		{40, 0, words + 2, "0000:"},
+		{13, 20, 12, "0015:"},
+		{13, 30, 12, "0022:"},
+		{2, 5, 3, "0005:"},
+	}
+
+	for i, tc := range cases {
+		b := NewBaby(loopMem())
+		b.ci = register(tc.ci)
+		lines := b.screenLines(tc.rows)
+		if len(lines) != tc.wantLines {
+			t.Errorf("case %d: got %d lines, want %d", i, len(lines), tc.wantLines)
+			continue
+		}
+		if !strings.HasPrefix(lines[0], "ci: ") {
+			t.Errorf("case %d: status line = %q", i, lines[0])
+		}
+		if !strings.HasPrefix(lines[1], tc.wantFirst) {
+			t.Errorf("case %d: first store line = %q, want %s", i, lines[1], tc.wantFirst)
+		}
+		if !strings.Contains(strings.Join(lines, "\n"), "<==") {
+			t.Errorf("case %d: ci not in view", i)
+		}
+		if lines[len(lines)-1] != "" {
+			t.Errorf("case %d: no blank line above the command bar", i)
+		}
+	}
+}
+
+func TestStoreLine(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.ci = 1
+
+	if got, want := b.storeLine(1), "0001:#.#............#................ |  <== [SUB 5    ;        32773]"; got != want {
+		t.Errorf("storeLine(1) = %q, want %q", got, want)
+	}
+	if got := b.storeLine(2); strings.Contains(got, "<==") {
+		t.Errorf("storeLine(2) = %q marks the ci", got)
+	}
+}
+
+func TestDots(t *testing.T) {
+	cases := []struct {
+		w            int32
+		want, invert string
+	}{
+		{0, "................................", "################################"},
+		{-1, "################################", "................................"},
+		{5, "#.#.............................", ".#.#############################"},
+	}
+
+	for i, tc := range cases {
+		if got := dots(tc.w, false); got != tc.want {
+			t.Errorf("case %d: got(%q) != want(%q)", i, got, tc.want)
+		}
+		if got := dots(tc.w, true); got != tc.invert {
+			t.Errorf("case %d: inverted got(%q) != want(%q)", i, got, tc.invert)
+		}
+	}
+
+	b := NewBaby(loopMem())
+	normal := b.storeLine(1)
+	b.invertDots = true
+	if got, want := b.storeLine(1), strings.Replace(normal, dots(b.mem[1], false), dots(b.mem[1], true), 1); got != want {
+		t.Errorf("inverted storeLine(1) = %q, want %q", got, want)
+	}
+}
+
+func TestRegisterLine(t *testing.T) {
+	b := NewBaby(memory{})
+	b.ci, b.acc = 5, -6
+
+	want := "ci: 5 (0x00000005 10100000000000000000000000000000), acc: -6 (0xFFFFFFFA 01011111111111111111111111111111), running: true, next: JMP 0"
+	if got := b.registerLine(); got != want {
+		t.Errorf("registerLine() = %q, want %q", got, want)
+	}
+	if got := b.screenLines(0)[0]; got != want {
+		t.Errorf("status line = %q, want %q", got, want)
+	}
+
+	// There's no next instruction to show once ci reaches the end.
+	b.ci = words - 1
+	if got := b.registerLine(); strings.Contains(got, "next:") {
+		t.Errorf("registerLine() at the end of the store = %q", got)
+	}
+}
+
+func TestAccAddress(t *testing.T) {
+	cases := []struct {
+		acc  register
+		want int32
+	}{
+		{0, 0},
+		{5, 5},
+		{31, 31},
+		{32, 0},
+		{37, 5},
+		{-1, 31},
+		{-27, 5},
+	}
+
+	for i, tc := range cases {
+		if got := accAddress(tc.acc); got != tc.want {
+			t.Errorf("case %d: got(%d) != want(%d)", i, got, tc.want)
+		}
+	}
+
+	b := NewBaby(loopMem())
+	b.acc = 37
+	if got := b.registerLine(); strings.Contains(got, "acc ->") {
+		t.Errorf("registerLine() without showAccAddr = %q", got)
+	}
+	b.showAccAddr = true
+	want := fmt.Sprintf(", acc -> 0005: %d [%s]", b.mem[5], instFromWord(b.mem[5]))
+	if got := b.registerLine(); !strings.HasSuffix(got, want) {
+		t.Errorf("registerLine() = %q, want it to end %q", got, want)
+	}
+}
+
+func TestHeatBucket(t *testing.T) {
+	cases := []struct {
+		count, max int64
+		want       int
+	}{
+		{0, 0, 0},
+		{0, 10, 0},
+		{1, 1, 4},
+		{1, 100, 1},
+		{25, 100, 1},
+		{26, 100, 2},
+		{50, 100, 2},
+		{51, 100, 3},
+		{75, 100, 3},
+		{76, 100, 4},
+		{100, 100, 4},
+	}
+
+	for i, tc := range cases {
+		if got := heatBucket(tc.count, tc.max); got != tc.want {
+			t.Errorf("case %d: got(%d) != want(%d)", i, got, tc.want)
+		}
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	b := NewBaby(loopMem())
+	b.StepN(5) // line 1 runs 3 times and line 2 twice
+
+	if got := b.storeLine(1); strings.Contains(got, "\033[") {
+		t.Errorf("storeLine(1) = %q is coloured with the heatmap off", got)
+	}
+
+	b.heatmap = true
+	cases := []struct {
+		row  int
+		want string
+	}{
+		{1, heatColours[4]},
+		{2, heatColours[3]},
+		{3, ""},
+	}
+	for i, tc := range cases {
+		got := b.storeLine(tc.row)
+		b.heatmap = false
+		plain := b.storeLine(tc.row)
+		b.heatmap = true
+		if want := colour(plain, tc.want); got != want {
+			t.Errorf("case %d: got(%q) != want(%q)", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var vectorMismatch = errors.New("invalid result - test vector not reproduced")
+
+// VectorState is the machine state a test vector starts from or ends in.
+type VectorState struct {
+	Mem     memory
+	CI, ACC int32
+	Running bool
+}
+
+// TestVector is a golden test case: running Steps steps from Start must
+// end in Final.
+type TestVector struct {
+	Start, Final VectorState
+	Steps        int
+}
+
+// GenerateTestVector runs the next n steps, or until the machine stops, on
+// a copy of the machine and returns a test vector for each step executed.
+// Print them with %#v for Go source to paste into a test.
+func (b *baby) GenerateTestVector(n int) []TestVector {
+	c := b.clone()
+	c.SetHistoryDepth(0)
+	c.SetMaxSteps(0)
+	c.breakpoints, c.watchpoints, c.bitWatches = nil, nil, nil
+	c.Unprotect()
+
+	var vs []TestVector
+	for i := 0; i < n && c.running; i++ {
+		start := c.vectorState()
+		if _, err := c.Step(); err != nil {
+			break // Only a bad ci is left, and the step didn't execute.
+		}
+		vs = append(vs, TestVector{Start: start, Final: c.vectorState(), Steps: 1})
+	}
+
+	return vs
+}
+
+func (b *baby) vectorState() VectorState {
+	return VectorState{Mem: b.mem, CI: int32(b.ci), ACC: int32(b.acc), Running: b.running}
+}
+
+// Verify runs the vector on a new machine, returning vectorMismatch if it
+// doesn't end in the Final state.
+func (v TestVector) Verify() error {
+	b := NewBaby(v.Start.Mem)
+	b.ci, b.acc, b.running = register(v.Start.CI), register(v.Start.ACC), v.Start.Running
+	b.StepN(v.Steps)
+
+	if got := b.vectorState(); got != v.Final {
+		return fmt.Errorf("%w: got %#v, want %#v", vectorMismatch, got, v.Final)
+	}
+
+	return nil
+}
+
+// GoString returns the vector as a Go composite literal.
+func (v TestVector) GoString() string {
+	return fmt.Sprintf("TestVector{Start: %#v, Final: %#v, Steps: %d}", v.Start, v.Final, v.Steps)
+}
+
+// GoString returns the state as a Go composite literal, listing only the
+// non-zero words of the store.
+func (s VectorState) GoString() string {
+	var ws []string
+	for addr, w := range s.Mem {
+		if w != 0 {
+			ws = append(ws, fmt.Sprintf("%d: %d", addr, w))
+		}
+	}
+
+	return fmt.Sprintf("VectorState{Mem: memory{%s}, CI: %d, ACC: %d, Running: %t}", strings.Join(ws, ", "), s.CI, s.ACC, s.Running)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// evalVector evaluates the Go source for a TestVector, as printed by
+// GoString.
+func evalVector(t *testing.T, src string) TestVector {
+	t.Helper()
+
+	e, err := parser.ParseExpr(src)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+
+	var v TestVector
+	for _, f := range fields(t, e, "TestVector") {
+		switch f.Key.(*ast.Ident).Name {
+		case "Start":
+			v.Start = evalState(t, f.Value)
+		case "Final":
+			v.Final = evalState(t, f.Value)
+		case "Steps":
+			v.Steps = int(evalInt(t, f.Value))
+		}
+	}
+
+	return v
+}
+
+func evalState(t *testing.T, e ast.Expr) VectorState {
+	var s VectorState
+	for _, f := range fields(t, e, "VectorState") {
+		switch f.Key.(*ast.Ident).Name {
+		case "Mem":
+			for _, w := range fields(t, f.Value, "memory") {
+				s.Mem[evalInt(t, w.Key)] = evalInt(t, w.Value)
+			}
+		case "CI":
+			s.CI = evalInt(t, f.Value)
+		case "ACC":
+			s.ACC = evalInt(t, f.Value)
+		case "Running":
+			s.Running = f.Value.(*ast.Ident).Name == "true"
+		}
+	}
+
+	return s
+}
+
+// fields returns the keyed elements of a composite literal of type name.
+func fields(t *testing.T, e ast.Expr, name string) []*ast.KeyValueExpr {
+	lit, ok := e.(*ast.CompositeLit)
+	if !ok || lit.Type.(*ast.Ident).Name != name {
+		t.Fatalf("want a %s literal, got %T", name, e)
+	}
+
+	var kvs []*ast.KeyValueExpr
+	for _, elt := range lit.Elts {
+		kvs = append(kvs, elt.(*ast.KeyValueExpr))
+	}
+
+	return kvs
+}
+
+func evalInt(t *testing.T, e ast.Expr) int32 {
+	sign := int64(1)
+	if u, ok := e.(*ast.UnaryExpr); ok && u.Op == token.SUB {
+		sign, e = -1, u.X
+	}
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		t.Fatalf("want an integer, got %T", e)
+	}
+	v, err := strconv.ParseInt(lit.Value, 10, 64)
+	if err != nil {
+		t.Fatalf("bad integer %q: %v", lit.Value, err)
+	}
+
+	return int32(sign * v)
+}
+
+func TestGenerateTestVector(t *testing.T) {
+	mem, err := loadProgram("test.baby")
+	if err != nil {
+		t.Fatalf("loadProgram: unexpected error: %v", err)
+	}
+
+	b := NewBaby(mem)
+	vs := b.GenerateTestVector(1000)
+	if b.cycles != 0 || b.mem != mem {
+		t.Errorf("GenerateTestVector changed the machine")
+	}
+	if len(vs) == 0 || vs[len(vs)-1].Final.Running {
+		t.Fatalf("got %d vectors, want them to run to the STP", len(vs))
+	}
+	if got := b.GenerateTestVector(3); len(got) != 3 {
+		t.Errorf("GenerateTestVector(3) returned %d vectors", len(got))
+	}
+
+	for i, v := range vs {
+		src := fmt.Sprintf("%#v", v)
+		got := evalVector(t, src)
+		if got != v {
+			t.Fatalf("vector %d: %s evaluated to %#v", i, src, got)
+		}
+		if err := got.Verify(); err != nil {
+			t.Errorf("vector %d: Verify() = %v", i, err)
+		}
+	}
+
+	vs[0].Final.ACC++
+	if err := vs[0].Verify(); err == nil {
+		t.Errorf("Verify() of an altered vector succeeded")
+	}
+}
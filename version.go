@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// version may be overridden at build time with
+// -ldflags "-X main.version=v1.2.3".
+var version = "devel"
+
+// writeVersion writes the version of the binary to w, along with the VCS
+// revision and the time of that commit when the build recorded them.
+func writeVersion(w io.Writer) {
+	fmt.Fprintf(w, "manchester-baby %s\n", version)
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+
+	fmt.Fprintf(w, "go: %s\n", info.GoVersion)
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			fmt.Fprintf(w, "revision: %s\n", s.Value)
+		case "vcs.time":
+			fmt.Fprintf(w, "committed: %s\n", s.Value)
+		case "vcs.modified":
+			if s.Value == "true" {
+				fmt.Fprintln(w, "modified: true")
+			}
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteVersion(t *testing.T) {
+	var buf bytes.Buffer
+	writeVersion(&buf)
+
+	if !strings.HasPrefix(buf.String(), "manchester-baby "+version+"\n") {
+		t.Errorf("writeVersion wrote %q, want it to start with the version", buf.String())
+	}
+}